@@ -0,0 +1,33 @@
+// fakekis 통합 테스트용 가짜 KIS Open API 서버
+//
+//	go run ./cmd/fakekis -addr :9443 -balance 100000
+//
+// 키오스크 서버는 KIS_ENV=custom, KIS_BASE_URL=http://localhost:9443 으로 이 서버를 사용합니다.
+package main
+
+import (
+	"flag"
+	"kiosk/fakekis"
+	"log"
+	"net/http"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":9443", "listen address")
+	balance := flag.Int64("balance", 0, "initial deposit balance for every account")
+	appKey := flag.String("app-key", "", "required appkey (empty accepts any)")
+	appSecret := flag.String("app-secret", "", "required appsecret (empty accepts any)")
+	tokenTTL := flag.Duration("token-ttl", 24*time.Hour, "access token lifetime")
+	flag.Parse()
+
+	server := fakekis.New(fakekis.Config{
+		AppKey:         *appKey,
+		AppSecret:      *appSecret,
+		InitialBalance: *balance,
+		TokenTTL:       *tokenTTL,
+	})
+
+	log.Printf("가짜 KIS 서버가 %s 에서 시작되었습니다 (제어: /_control/state)", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -16,7 +16,15 @@ func InitDB() error {
     }
 
     // 테이블 자동 생성
-    err = DB.AutoMigrate(&models.Category{}, &models.Menu{}, &models.Order{}, &models.OrderItem{})
+    err = DB.AutoMigrate(&models.Category{}, &models.Menu{}, &models.Order{}, &models.OrderItem{}, &models.Payment{}, &models.Refund{}, &models.DepositMovement{})
+    if err != nil {
+        return err
+    }
+
+    // paid_at 도입 전의 결제 완료 주문은 주문 시각을 결제 완료 시각으로 채움 (취소/환불, 매출, 대사 기준)
+    err = DB.Model(&models.Order{}).
+        Where("status = ? AND paid_at IS NULL", models.OrderStatusPaid).
+        Update("paid_at", gorm.Expr("created_at")).Error
     if err != nil {
         return err
     }
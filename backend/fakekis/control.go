@@ -0,0 +1,110 @@
+package fakekis
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// registerControl 테스트 제어용 엔드포인트 등록
+//
+//	GET  /_control/state          잔고, 토큰 수, 장애, 통계 조회
+//	POST /_control/deposit        {"account": "", "amount": 4500}
+//	POST /_control/balance        {"account": "", "amount": 100000}
+//	POST /_control/fault          Fault JSON
+//	DELETE /_control/fault        장애 제거
+//	POST /_control/latency        {"endpoint": "balance", "ms": 1500}
+//	POST /_control/expire-tokens  발급된 토큰 만료
+//	POST /_control/reset          초기화
+func (s *Server) registerControl() {
+	s.mux.HandleFunc("GET /_control/state", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		faults := make([]Fault, 0, len(s.faults))
+		for _, f := range s.faults {
+			faults = append(faults, *f)
+		}
+		latency := make(map[string]int64, len(s.latency))
+		for endpoint, d := range s.latency {
+			latency[endpoint] = d.Milliseconds()
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"default_balance": s.cfg.InitialBalance,
+			"balances":        s.balances,
+			"tokens":          len(s.tokens),
+			"faults":          faults,
+			"latency_ms":      latency,
+			"stats":           s.stats,
+		})
+	})
+
+	s.mux.HandleFunc("POST /_control/deposit", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Account string `json:"account"`
+			Amount  int64  `json:"amount"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		s.Deposit(req.Account, req.Amount)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account": req.Account, "balance": s.Balance(req.Account)})
+	})
+
+	s.mux.HandleFunc("POST /_control/balance", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Account string `json:"account"`
+			Amount  int64  `json:"amount"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		s.SetBalance(req.Account, req.Amount)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account": req.Account, "balance": s.Balance(req.Account)})
+	})
+
+	s.mux.HandleFunc("POST /_control/fault", func(w http.ResponseWriter, r *http.Request) {
+		var f Fault
+		if !decode(w, r, &f) {
+			return
+		}
+		s.InjectFault(f)
+		writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+	})
+
+	s.mux.HandleFunc("DELETE /_control/fault", func(w http.ResponseWriter, r *http.Request) {
+		s.ClearFaults()
+		writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+	})
+
+	s.mux.HandleFunc("POST /_control/latency", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Endpoint string `json:"endpoint"`
+			Ms       int64  `json:"ms"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		s.SetLatency(req.Endpoint, time.Duration(req.Ms)*time.Millisecond)
+		writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+	})
+
+	s.mux.HandleFunc("POST /_control/expire-tokens", func(w http.ResponseWriter, r *http.Request) {
+		s.ExpireTokens()
+		writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+	})
+
+	s.mux.HandleFunc("POST /_control/reset", func(w http.ResponseWriter, r *http.Request) {
+		s.Reset()
+		writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+	})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
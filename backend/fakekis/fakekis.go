@@ -0,0 +1,388 @@
+// Package fakekis 한국투자증권(KIS) Open API의 토큰 발급과 잔고 조회를 흉내 내는 테스트용 서버
+//
+// utils.KISApi가 사용하는 두 엔드포인트만 구현합니다.
+//
+//	POST /oauth2/tokenP
+//	GET  /uapi/domestic-stock/v1/trading/inquire-balance
+//
+// 응답 형식(rt_cd, msg1, output2[].dnca_tot_amt)은 실제 API와 같으며,
+// 입금/오류/지연/토큰 만료를 Go 메서드 또는 /_control/ 엔드포인트로 발생시킬 수 있습니다.
+//
+//	srv := httptest.NewServer(fakekis.New(fakekis.Config{InitialBalance: 10000}))
+//	config := utils.DefaultKISConfig(utils.KISEnvCustom)
+//	config.BaseURL = srv.URL
+//	config.AppKey, config.AppSecret, config.AccountNo = "key", "secret", "12345678"
+//	kisApi := utils.NewKISApiFromConfig(config)
+package fakekis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 엔드포인트 이름 (장애/지연 주입 대상)
+const (
+	EndpointToken   = "token"
+	EndpointBalance = "balance"
+	EndpointAll     = "*"
+)
+
+// 실제 KIS가 만료된 토큰에 대해 반환하는 메시지 코드
+const MsgCdTokenExpired = "EGW00123"
+
+// Config 가짜 서버 설정
+type Config struct {
+	AppKey         string        // 비어 있지 않으면 요청의 appkey와 일치해야 함
+	AppSecret      string        // 비어 있지 않으면 요청의 appsecret과 일치해야 함
+	InitialBalance int64         // 모든 계좌의 초기 예수금
+	TokenTTL       time.Duration // 발급 토큰 유효 기간 (기본 24시간)
+}
+
+// Fault 주입할 장애
+// Status가 200이 아니면 해당 HTTP 상태로, RtCd가 "0"이 아니면 rt_cd 오류 응답으로 처리합니다.
+type Fault struct {
+	Endpoint string `json:"endpoint"`       // token, balance, * (기본 *)
+	Status   int    `json:"status"`         // HTTP 상태 (기본 200)
+	RtCd     string `json:"rt_cd"`          // 응답 rt_cd (기본 "1")
+	MsgCd    string `json:"msg_cd"`         // 응답 msg_cd
+	Msg1     string `json:"msg1"`           // 응답 msg1
+	Count    int    `json:"count"`          // 적용 횟수 (0 이하면 Clear 전까지 계속)
+	Drop     bool   `json:"drop,omitempty"` // 응답 없이 연결 종료
+}
+
+// Stats 엔드포인트별 요청 수
+type Stats struct {
+	TokenRequests   int `json:"token_requests"`
+	BalanceRequests int `json:"balance_requests"`
+}
+
+// Server 가짜 KIS Open API 서버 (http.Handler)
+type Server struct {
+	mu       sync.Mutex
+	cfg      Config
+	balances map[string]int64     // 계좌번호(CANO)별 예수금
+	tokens   map[string]time.Time // 발급된 토큰과 만료 시각
+	faults   []*Fault
+	latency  map[string]time.Duration
+	stats    Stats
+	mux      *http.ServeMux
+}
+
+// New 새로운 가짜 서버 생성
+func New(cfg Config) *Server {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = 24 * time.Hour
+	}
+	s := &Server{cfg: cfg}
+	s.resetLocked()
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /oauth2/tokenP", s.handleToken)
+	s.mux.HandleFunc("GET /uapi/domestic-stock/v1/trading/inquire-balance", s.handleBalance)
+	s.registerControl()
+	return s
+}
+
+// ServeHTTP http.Handler 구현
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) resetLocked() {
+	s.balances = make(map[string]int64)
+	s.tokens = make(map[string]time.Time)
+	s.faults = nil
+	s.latency = make(map[string]time.Duration)
+	s.stats = Stats{}
+}
+
+// Reset 잔고, 토큰, 장애, 지연, 통계를 초기 상태로 되돌림
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetLocked()
+}
+
+// Deposit 계좌에 입금 (음수면 출금). account가 비어 있으면 모든 계좌에 적용
+func (s *Server) Deposit(account string, amount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if account == "" {
+		s.cfg.InitialBalance += amount
+		for key := range s.balances {
+			s.balances[key] += amount
+		}
+		return
+	}
+	s.balances[account] = s.balanceLocked(account) + amount
+}
+
+// SetBalance 계좌 예수금 설정. account가 비어 있으면 모든 계좌에 적용
+func (s *Server) SetBalance(account string, amount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if account == "" {
+		s.cfg.InitialBalance = amount
+		for key := range s.balances {
+			s.balances[key] = amount
+		}
+		return
+	}
+	s.balances[account] = amount
+}
+
+// Balance 계좌 예수금 조회
+func (s *Server) Balance(account string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balanceLocked(account)
+}
+
+func (s *Server) balanceLocked(account string) int64 {
+	if balance, ok := s.balances[account]; ok {
+		return balance
+	}
+	return s.cfg.InitialBalance
+}
+
+// InjectFault 장애 주입
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Endpoint == "" {
+		f.Endpoint = EndpointAll
+	}
+	if f.Status == 0 {
+		f.Status = http.StatusOK
+	}
+	if f.RtCd == "" {
+		f.RtCd = "1"
+	}
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults 주입된 장애 제거
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// SetLatency 엔드포인트 응답 지연 설정 (0이면 해제)
+func (s *Server) SetLatency(endpoint string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if endpoint == "" {
+		endpoint = EndpointAll
+	}
+	if d <= 0 {
+		delete(s.latency, endpoint)
+		return
+	}
+	s.latency[endpoint] = d
+}
+
+// ExpireTokens 발급된 모든 토큰을 만료시킴
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token := range s.tokens {
+		s.tokens[token] = time.Now().Add(-time.Second)
+	}
+}
+
+// Stats 요청 통계
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// before 지연과 장애를 적용합니다. 장애 응답을 보냈으면 true를 반환합니다.
+func (s *Server) before(w http.ResponseWriter, endpoint string) bool {
+	s.mu.Lock()
+	delay := s.latency[endpoint] + s.latency[EndpointAll]
+	var fault *Fault
+	for i, f := range s.faults {
+		if f.Endpoint != endpoint && f.Endpoint != EndpointAll {
+			continue
+		}
+		copied := *f
+		fault = &copied
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		break
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if fault == nil {
+		return false
+	}
+
+	if fault.Drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		return true
+	}
+
+	writeJSON(w, fault.Status, map[string]interface{}{
+		"rt_cd":  fault.RtCd,
+		"msg_cd": fault.MsgCd,
+		"msg1":   fault.Msg1,
+	})
+	return true
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.stats.TokenRequests++
+	s.mu.Unlock()
+
+	if s.before(w, EndpointToken) {
+		return
+	}
+
+	var req struct {
+		GrantType string `json:"grant_type"`
+		AppKey    string `json:"appkey"`
+		AppSecret string `json:"appsecret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GrantType != "client_credentials" {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error_code":        "EGW00002",
+			"error_description": "잘못된 요청입니다.",
+		})
+		return
+	}
+	if (s.cfg.AppKey != "" && req.AppKey != s.cfg.AppKey) || (s.cfg.AppSecret != "" && req.AppSecret != s.cfg.AppSecret) {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error_code":        "EGW00103",
+			"error_description": "유효하지 않은 AppKey입니다.",
+		})
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error_code":        "EGW00001",
+			"error_description": "토큰을 발급할 수 없습니다.",
+		})
+		return
+	}
+	expiresAt := time.Now().Add(s.cfg.TokenTTL)
+
+	s.mu.Lock()
+	s.tokens[token] = expiresAt
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":               token,
+		"access_token_token_expired": expiresAt.Format("2006-01-02 15:04:05"),
+		"token_type":                 "Bearer",
+		"expires_in":                 int(s.cfg.TokenTTL.Seconds()),
+	})
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.stats.BalanceRequests++
+	s.mu.Unlock()
+
+	if s.before(w, EndpointBalance) {
+		return
+	}
+
+	// 토큰 확인
+	auth := r.Header.Get("authorization")
+	token := ""
+	if len(auth) > len("Bearer ") {
+		token = auth[len("Bearer "):]
+	}
+	s.mu.Lock()
+	expiresAt, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"rt_cd": "1", "msg_cd": "EGW00121", "msg1": "유효하지 않은 token 입니다.",
+		})
+		return
+	}
+	if time.Now().After(expiresAt) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"rt_cd": "1", "msg_cd": MsgCdTokenExpired, "msg1": "기간이 만료된 token 입니다.",
+		})
+		return
+	}
+
+	if s.cfg.AppKey != "" && r.Header.Get("appkey") != s.cfg.AppKey {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"rt_cd": "1", "msg_cd": "EGW00103", "msg1": "유효하지 않은 AppKey입니다.",
+		})
+		return
+	}
+
+	trID := r.Header.Get("tr_id")
+	if trID != "TTTC8434R" && trID != "VTTC8434R" {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"rt_cd": "1", "msg_cd": "EGW00205", "msg1": "tr_id를 확인해주세요.",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	cano := query.Get("CANO")
+	if cano == "" {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"rt_cd": "2", "msg_cd": "OPSQ2001", "msg1": "ERROR : INPUT_FIELD_NAME CANO",
+		})
+		return
+	}
+
+	balance := s.Balance(cano)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rt_cd":   "0",
+		"msg_cd":  "KIOK0510",
+		"msg1":    "조회가 완료되었습니다                                                           ",
+		"output1": []interface{}{},
+		"output2": []map[string]string{{
+			"dnca_tot_amt":       strconv.FormatInt(balance, 10),
+			"nxdy_excc_amt":      strconv.FormatInt(balance, 10),
+			"prvs_rcdl_excc_amt": strconv.FormatInt(balance, 10),
+			"tot_evlu_amt":       strconv.FormatInt(balance, 10),
+			"scts_evlu_amt":      "0",
+			"evlu_pfls_smtl_amt": "0",
+		}},
+	})
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
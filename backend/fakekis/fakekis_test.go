@@ -0,0 +1,120 @@
+package fakekis_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiosk/fakekis"
+	"kiosk/utils"
+)
+
+const testAccount = "12345678"
+
+// newClient 가짜 서버에 연결된 KIS API 클라이언트 (재시도 없음)
+func newClient(t *testing.T, cfg fakekis.Config) (*fakekis.Server, *utils.KISApi, string) {
+	t.Helper()
+	server := fakekis.New(cfg)
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	config := utils.DefaultKISConfig(utils.KISEnvCustom)
+	config.BaseURL = srv.URL
+	config.AppKey, config.AppSecret, config.AccountNo = "key", "secret", testAccount
+	config.MaxRetries = 0
+	if err := config.Validate(); err != nil {
+		t.Fatalf("설정 검증 실패: %v", err)
+	}
+	return server, utils.NewKISApiFromConfig(config), srv.URL
+}
+
+func depositAmount(t *testing.T, api *utils.KISApi) int64 {
+	t.Helper()
+	amount, err := api.GetDepositAmount()
+	if err != nil {
+		t.Fatalf("예수금 조회 실패: %v", err)
+	}
+	return amount
+}
+
+func TestBalanceFollowsDeposits(t *testing.T) {
+	server, api, _ := newClient(t, fakekis.Config{InitialBalance: 10000})
+
+	if got := depositAmount(t, api); got != 10000 {
+		t.Fatalf("초기 예수금 = %d, want 10000", got)
+	}
+
+	server.Deposit(testAccount, 4500)
+	if got := depositAmount(t, api); got != 14500 {
+		t.Fatalf("입금 후 예수금 = %d, want 14500", got)
+	}
+
+	// 계좌를 지정하지 않으면 모든 계좌에 적용
+	server.Deposit("", -500)
+	if got := depositAmount(t, api); got != 14000 {
+		t.Fatalf("전체 출금 후 예수금 = %d, want 14000", got)
+	}
+	if got := server.Balance("87654321"); got != 9500 {
+		t.Fatalf("다른 계좌 예수금 = %d, want 9500", got)
+	}
+}
+
+func TestExpiredTokenIsReissued(t *testing.T) {
+	server, api, _ := newClient(t, fakekis.Config{InitialBalance: 10000})
+
+	depositAmount(t, api)
+	server.ExpireTokens()
+	if got := depositAmount(t, api); got != 10000 {
+		t.Fatalf("토큰 만료 후 예수금 = %d, want 10000", got)
+	}
+
+	stats := server.Stats()
+	if stats.TokenRequests != 2 {
+		t.Fatalf("토큰 발급 요청 %d회, want 2", stats.TokenRequests)
+	}
+	if stats.BalanceRequests != 3 {
+		t.Fatalf("잔고 조회 요청 %d회, want 3 (만료 응답 후 재시도 포함)", stats.BalanceRequests)
+	}
+}
+
+func TestInjectedFaultIsConsumed(t *testing.T) {
+	server, api, _ := newClient(t, fakekis.Config{InitialBalance: 10000})
+
+	server.InjectFault(fakekis.Fault{Endpoint: fakekis.EndpointBalance, Status: http.StatusInternalServerError, Count: 1})
+	if _, err := api.GetDepositAmount(); err == nil {
+		t.Fatal("장애 주입 후 예수금 조회가 성공함")
+	}
+	if got := depositAmount(t, api); got != 10000 {
+		t.Fatalf("장애 해제 후 예수금 = %d, want 10000", got)
+	}
+}
+
+func TestRejectsWrongAppKey(t *testing.T) {
+	_, api, _ := newClient(t, fakekis.Config{AppKey: "other", InitialBalance: 10000})
+
+	if _, err := api.GetDepositAmount(); err == nil {
+		t.Fatal("다른 앱키로 예수금 조회가 성공함")
+	}
+}
+
+func TestControlDeposit(t *testing.T) {
+	server, api, url := newClient(t, fakekis.Config{InitialBalance: 10000})
+
+	resp, err := http.Post(url+"/_control/deposit", "application/json",
+		bytes.NewBufferString(`{"account": "12345678", "amount": 3000}`))
+	if err != nil {
+		t.Fatalf("입금 요청 실패: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("입금 요청 상태 = %d, want 200", resp.StatusCode)
+	}
+
+	if got := server.Balance(testAccount); got != 13000 {
+		t.Fatalf("입금 후 서버 예수금 = %d, want 13000", got)
+	}
+	if got := depositAmount(t, api); got != 13000 {
+		t.Fatalf("입금 후 조회한 예수금 = %d, want 13000", got)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth 관리자 API 인증 미들웨어
+// Authorization: Bearer <token> 또는 X-Admin-Token 헤더가 ADMIN_TOKEN과 일치해야 합니다.
+// 토큰이 설정되지 않았으면 관리자 API는 비활성화됩니다.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "관리자 API가 비활성화되어 있습니다 (ADMIN_TOKEN 미설정)"})
+			return
+		}
+
+		provided := c.GetHeader("X-Admin-Token")
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "관리자 인증 실패"})
+			return
+		}
+
+		c.Next()
+	}
+}
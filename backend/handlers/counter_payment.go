@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CounterPaymentRequest 카운터 결제 확인 요청
+type CounterPaymentRequest struct {
+	Method         string `json:"method" binding:"required,oneof=cash manual"`
+	Amount         int64  `json:"amount"`          // 이 결제로 받을 금액 (비어 있으면 남은 금액 전체, 분할 결제 시 일부)
+	TenderedAmount int64  `json:"tendered_amount"` // 현금 결제 시 받은 금액 (비어 있으면 결제 금액)
+	ConfirmedBy    string `json:"confirmed_by"`
+	Note           string `json:"note"`
+}
+
+// ConfirmCounterPayment 카운터에서 받은 현금(또는 그 밖의 직원 확인 결제)으로 결제 대기 주문을 결제 완료 처리합니다.
+// 계좌 이체 결제와 같이 주문이 주방(SSE)에 전달되고 결제 기록이 생성되어 매출/대사 리포트에 반영됩니다.
+// amount로 남은 금액의 일부만 받으면 분할 결제의 일부가 되어 주문은 나머지가 결제될 때까지 결제 대기 상태로 남습니다.
+func ConfirmCounterPayment(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req CounterPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Method == models.PaymentMethodManual && req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "manual 결제는 메모(note)가 필요합니다"})
+		return
+	}
+
+	// 키오스크에서 진행 중인 이체 결제가 있으면 먼저 취소해야 함
+	paymentID := uuid.New().String()
+	order, err := claimOrderPayment(uint(orderID), paymentID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	defer releaseOrderPayment(order.ID, paymentID)
+
+	total, err := legAmountFor(order, req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tendered := req.TenderedAmount
+	if tendered == 0 {
+		tendered = total
+	}
+	if req.Method == models.PaymentMethodCash && tendered < total {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("받은 금액(%s원)이 결제 금액(%s원)보다 적습니다",
+			utils.FormatNumber(tendered), utils.FormatNumber(total))})
+		return
+	}
+	var changeDue int64
+	if req.Method == models.PaymentMethodCash {
+		changeDue = tendered - total
+	} else {
+		tendered = 0
+	}
+
+	now := time.Now()
+	payment := models.Payment{
+		PaymentID:      paymentID,
+		OrderID:        order.ID,
+		ExpectedAmount: total,
+		Provider:       req.Method,
+		Method:         req.Method,
+		ActualChange:   total,
+		Status:         models.PaymentStatusSucceeded,
+		StartedAt:      now,
+		FinishedAt:     &now,
+		TenderedAmount: tendered,
+		ChangeDue:      changeDue,
+		ConfirmedBy:    req.ConfirmedBy,
+		Note:           req.Note,
+	}
+
+	// 결제 기록을 먼저 생성 - 기록 없이 주문만 결제 완료되면 결제 목록, 매출, 대사 리포트에서 빠짐
+	if err := database.DB.Create(&payment).Error; err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, OrderID: order.ID},
+			"[중요] 결제 기록 생성 실패 - ID: %s, 오류: %v", paymentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("결제 기록 생성 실패: %v", err)})
+		return
+	}
+
+	order, remaining, err := settleOrderLeg(order.ID, payment)
+	if err != nil {
+		// 주문 상태를 바꾸지 못했으면 결제 기록을 지움
+		database.DB.Where("payment_id = ?", paymentID).Delete(&models.Payment{})
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("주문 상태 변경 실패: %v", err)})
+		return
+	}
+
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventCounterPayment, PaymentID: paymentID, OrderID: order.ID,
+		Status: req.Method, Amount: total, Received: tendered},
+		"[카운터 결제] 결제 확인 - 주문 ID: %d, 결제 ID: %s, 수단: %s, 금액: %s원, 받은 금액: %s원, 거스름돈: %s원, 남은 주문 금액: %s원, 확인: %s",
+		order.ID, paymentID, req.Method, utils.FormatNumber(total), utils.FormatNumber(tendered), utils.FormatNumber(changeDue),
+		utils.FormatNumber(remaining), req.ConfirmedBy)
+
+	c.JSON(http.StatusOK, gin.H{
+		"order":      order,
+		"payment":    payment,
+		"change_due": changeDue,
+		"remaining":  remaining,
+	})
+}
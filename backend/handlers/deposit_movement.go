@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// StartDepositRecorder 예수금 폴러가 관측한 변동을 입금 계좌별 DepositMovement로 기록합니다.
+// 결제에 할당되지 않은 변동(시간 초과 후 입금, 키오스크 밖 입금, 출금 등)은 직원 확인 대상으로 남습니다.
+func StartDepositRecorder(provider utils.PaymentProvider) {
+	events, _ := provider.Subscribe()
+	go func() {
+		for event := range events {
+			recordDepositMovement(provider.Name(), event)
+		}
+	}()
+}
+
+// recordDepositMovement 예수금 변동 한 건을 저장합니다
+func recordDepositMovement(provider string, event utils.DepositEvent) {
+	paymentIDs := make([]string, 0, len(event.Matches))
+	for _, match := range event.Matches {
+		paymentIDs = append(paymentIDs, match.PaymentID)
+	}
+
+	movement := models.DepositMovement{
+		ObservedAt:        event.ObservedAt,
+		Provider:          provider,
+		Account:           event.Account,
+		PreviousBalance:   event.PreviousDeposit,
+		Balance:           event.CurrentDeposit,
+		Delta:             event.Delta,
+		MatchedAmount:     event.Delta - event.Unmatched,
+		UnmatchedAmount:   event.Unmatched,
+		MatchedPaymentIDs: strings.Join(paymentIDs, ","),
+		Status:            models.DepositMovementMatched,
+	}
+	if event.Unmatched != 0 {
+		movement.Status = models.DepositMovementUnmatched
+	}
+	if err := database.DB.Create(&movement).Error; err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, Account: event.Account, Amount: event.Delta},
+			"[중요] 예수금 변동 기록 실패 - 변동: %s원, 오류: %v", utils.FormatNumber(event.Delta), err)
+		return
+	}
+	if movement.Status == models.DepositMovementUnmatched {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventDepositUnmatched, Level: utils.PaymentLogWarn, Account: movement.Account,
+			Amount: movement.UnmatchedAmount, DepositBefore: depositValue(movement.PreviousBalance), DepositAfter: depositValue(movement.Balance)},
+			"[주의] 결제에 할당되지 않은 예수금 변동 기록 - ID: %d, 계좌: %s, 금액: %s원, 예수금: %s원 → %s원",
+			movement.ID, movement.Account, utils.FormatNumber(movement.UnmatchedAmount),
+			utils.FormatNumber(movement.PreviousBalance), utils.FormatNumber(movement.Balance))
+	}
+}
+
+// GetDepositAccounts 입금 계좌별 예수금과 입금 대기 중인 결제 수
+func GetDepositAccounts(c *gin.Context) {
+	providerInterface, _ := c.Get("paymentProvider")
+	provider, ok := providerInterface.(utils.PaymentProvider)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "결제 제공자를 찾을 수 없습니다"})
+		return
+	}
+
+	accounts := provider.Accounts()
+	var totalBalance int64
+	totalPending := 0
+	for _, account := range accounts {
+		totalBalance += account.Balance
+		totalPending += account.PendingCount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"provider":      provider.Name(),
+		"count":         len(accounts),
+		"total_balance": totalBalance,
+		"total_pending": totalPending,
+		"accounts":      accounts,
+	})
+}
+
+// AssignDepositRequest 결제에 할당되지 않은 예수금 변동을 주문에 할당하는 요청
+type AssignDepositRequest struct {
+	OrderID    uint   `json:"order_id" binding:"required"`
+	Amount     int64  `json:"amount"` // 할당할 금액 (비어 있으면 할당되지 않은 금액 전체)
+	ResolvedBy string `json:"resolved_by"`
+	Note       string `json:"note"`
+}
+
+// DismissDepositRequest 결제와 무관한 예수금 변동으로 처리하는 요청
+type DismissDepositRequest struct {
+	ResolvedBy string `json:"resolved_by"`
+	Note       string `json:"note" binding:"required"`
+}
+
+// GetDepositMovements 관측된 예수금 변동 조회 (기본값: 직원 확인이 필요한 변동)
+func GetDepositMovements(c *gin.Context) {
+	query := database.DB.Model(&models.DepositMovement{})
+
+	status := c.DefaultQuery("status", models.DepositMovementUnmatched)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	// 입금 계좌 필터
+	if account := c.Query("account"); account != "" {
+		query = query.Where("account = ?", account)
+	}
+
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, _, err := parseLocalDay(startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 시작일 형식. YYYY-MM-DD 형식을 사용하세요"})
+			return
+		}
+		query = query.Where("observed_at >= ?", start)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		_, end, err := parseLocalDay(endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 종료일 형식. YYYY-MM-DD 형식을 사용하세요"})
+			return
+		}
+		query = query.Where("observed_at < ?", end)
+	}
+
+	var movements []models.DepositMovement
+	if err := query.Order("observed_at desc, id desc").Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var unmatchedTotal int64
+	for _, movement := range movements {
+		if movement.Status == models.DepositMovementUnmatched {
+			unmatchedTotal += movement.UnmatchedAmount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":          status,
+		"count":           len(movements),
+		"unmatched_total": unmatchedTotal,
+		"movements":       movements,
+	})
+}
+
+// AssignDepositMovement 결제에 할당되지 않은 입금을 결제되지 않은 주문(결제 대기, 시간 초과, 결제 오류)에 할당합니다.
+// 성공한 결제 기록이 생성되고, 주문의 남은 금액을 넘는 금액은 환불 대상으로 기록됩니다.
+// 남은 금액보다 적은 입금은 분할 결제의 일부로 반영되며, 남은 금액이 모두 결제되면 주문이 결제 완료로 전환되어 주방에 전달됩니다.
+func AssignDepositMovement(c *gin.Context) {
+	var movement models.DepositMovement
+	if err := database.DB.First(&movement, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deposit movement not found"})
+		return
+	}
+
+	var req AssignDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if movement.Status != models.DepositMovementUnmatched || movement.UnmatchedAmount <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "할당할 수 있는 입금이 없습니다"})
+		return
+	}
+	amount := req.Amount
+	if amount == 0 {
+		amount = movement.UnmatchedAmount
+	}
+	if amount < 0 || amount > movement.UnmatchedAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("할당 금액은 할당되지 않은 금액(%s원) 이하여야 합니다", utils.FormatNumber(movement.UnmatchedAmount))})
+		return
+	}
+
+	// 처리하는 동안 같은 주문의 결제가 시작되지 않도록 잡아둠
+	paymentID := uuid.New().String()
+	order, err := claimOrderPayment(req.OrderID, paymentID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	defer releaseOrderPayment(order.ID, paymentID)
+
+	remaining, err := orderRemaining(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if remaining <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "이미 주문 금액만큼 결제되었습니다"})
+		return
+	}
+	leg := amount
+	if leg > remaining {
+		leg = remaining
+	}
+
+	// 예수금 변동 선점 (동시에 같은 입금을 할당하지 않도록 조건부 UPDATE)
+	paymentIDs := paymentID
+	if movement.MatchedPaymentIDs != "" {
+		paymentIDs = movement.MatchedPaymentIDs + "," + paymentID
+	}
+	status := models.DepositMovementAssigned
+	if movement.UnmatchedAmount-amount != 0 {
+		status = models.DepositMovementUnmatched
+	}
+	now := time.Now()
+	result := database.DB.Model(&models.DepositMovement{}).
+		Where("id = ? AND status = ? AND unmatched_amount = ?", movement.ID, models.DepositMovementUnmatched, movement.UnmatchedAmount).
+		Updates(map[string]interface{}{
+			"matched_amount":      movement.MatchedAmount + amount,
+			"unmatched_amount":    movement.UnmatchedAmount - amount,
+			"matched_payment_ids": paymentIDs,
+			"status":              status,
+			"resolved_by":         req.ResolvedBy,
+			"resolved_at":         &now,
+			"note":                req.Note,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "예수금 변동이 이미 처리되었습니다"})
+		return
+	}
+
+	surplus := amount - leg
+	// 결제 시각은 할당한 시각이 아닌 입금이 관측된 시각 (대사 리포트에서 입금과 같은 영업일로 집계)
+	observedAt := movement.ObservedAt
+	payment := models.Payment{
+		PaymentID:       paymentID,
+		OrderID:         order.ID,
+		ExpectedAmount:  leg,
+		Provider:        movement.Provider,
+		Account:         movement.Account,
+		Method:          models.PaymentMethodTransfer,
+		DepositBaseline: movement.PreviousBalance,
+		ActualChange:    amount,
+		RefundDue:       surplus,
+		Status:          models.PaymentStatusSucceeded,
+		StartedAt:       observedAt,
+		FinishedAt:      &observedAt,
+		ConfirmedBy:     req.ResolvedBy,
+		Note:            req.Note,
+	}
+
+	// 처리에 실패하면 예수금 변동을 원래대로 되돌림
+	restoreMovement := func() {
+		database.DB.Model(&models.DepositMovement{}).Where("id = ?", movement.ID).
+			Updates(map[string]interface{}{
+				"matched_amount":      movement.MatchedAmount,
+				"unmatched_amount":    movement.UnmatchedAmount,
+				"matched_payment_ids": movement.MatchedPaymentIDs,
+				"status":              movement.Status,
+				"resolved_by":         movement.ResolvedBy,
+				"resolved_at":         movement.ResolvedAt,
+				"note":                movement.Note,
+			})
+	}
+
+	// 결제 기록을 먼저 생성 - 기록 없이 주문만 결제 완료되면 입금 내역과 매출이 맞지 않음
+	if err := database.DB.Create(&payment).Error; err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, OrderID: order.ID},
+			"[중요] 결제 기록 생성 실패 - ID: %s, 오류: %v", paymentID, err)
+		restoreMovement()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("결제 기록 생성 실패: %v", err)})
+		return
+	}
+
+	if order, remaining, err = settleOrderLeg(order.ID, payment); err != nil {
+		// 주문 상태를 바꾸지 못했으면 결제 기록을 지우고 예수금 변동을 되돌림
+		database.DB.Where("payment_id = ?", paymentID).Delete(&models.Payment{})
+		restoreMovement()
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("주문 상태 변경 실패: %v", err)})
+		return
+	}
+
+	recordPaymentRefund(paymentID, order.ID, surplus, models.RefundSourceOverpaid, "초과 입금 (직원 할당)")
+
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventDepositAssigned, PaymentID: paymentID, OrderID: order.ID, Account: movement.Account,
+		Amount: amount, Expected: leg, Received: amount},
+		"[할당] 예수금 변동을 주문에 할당 - 변동 ID: %d, 주문 ID: %d, 결제 ID: %s, 금액: %s원, 환불 필요: %s원, 남은 주문 금액: %s원, 처리자: %s",
+		movement.ID, order.ID, paymentID, utils.FormatNumber(amount), utils.FormatNumber(surplus), utils.FormatNumber(remaining), req.ResolvedBy)
+
+	database.DB.First(&movement, movement.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"movement":  movement,
+		"payment":   payment,
+		"order":     order,
+		"remaining": remaining,
+	})
+}
+
+// DismissDepositMovement 결제와 무관한 예수금 변동(출금, 주식 매매, 이자 등)으로 확인 처리합니다
+func DismissDepositMovement(c *gin.Context) {
+	var movement models.DepositMovement
+	if err := database.DB.First(&movement, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deposit movement not found"})
+		return
+	}
+
+	var req DismissDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.DepositMovement{}).
+		Where("id = ? AND status = ?", movement.ID, models.DepositMovementUnmatched).
+		Updates(map[string]interface{}{
+			"status":      models.DepositMovementDismissed,
+			"resolved_by": req.ResolvedBy,
+			"resolved_at": &now,
+			"note":        req.Note,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "확인이 필요한 예수금 변동이 아닙니다"})
+		return
+	}
+
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventDepositDismissed, Account: movement.Account, Amount: movement.UnmatchedAmount},
+		"[할당] 결제와 무관한 예수금 변동 확인 - 변동 ID: %d, 금액: %s원, 처리자: %s, 메모: %s",
+		movement.ID, utils.FormatNumber(movement.UnmatchedAmount), req.ResolvedBy, req.Note)
+
+	database.DB.First(&movement, movement.ID)
+	c.JSON(http.StatusOK, movement)
+}
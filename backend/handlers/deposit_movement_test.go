@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kiosk/database"
+	"kiosk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAssignDepositReconcilesOnObservedDay(t *testing.T) {
+	// 전날 관측되었지만 결제에 할당되지 않은 입금과 그날의 결제 대기 주문
+	observedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	order := models.Order{TotalPrice: 3000, Status: models.OrderStatusPendingPayment, CreatedAt: observedAt.Add(-time.Minute)}
+	if err := database.DB.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	movement := models.DepositMovement{
+		ObservedAt:      observedAt,
+		Provider:        "simulator",
+		Account:         "sim-assign",
+		PreviousBalance: 10000,
+		Balance:         13000,
+		Delta:           3000,
+		UnmatchedAmount: 3000,
+		Status:          models.DepositMovementUnmatched,
+	}
+	if err := database.DB.Create(&movement).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	before, err := buildReconciliation(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 다음 날 직원이 입금을 주문에 할당함
+	r := gin.New()
+	r.POST("/deposits/:id/assign", AssignDepositMovement)
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"order_id": %d, "resolved_by": "staff"}`, order.ID)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/deposits/%d/assign", movement.ID), strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("입금 할당 상태 = %d (%s), want 200", w.Code, w.Body.String())
+	}
+
+	// 입금이 관측된 날: 할당된 입금과 결제가 맞고, 주문 금액은 결제 완료되는 날의 매출
+	observed, err := buildReconciliation(observedAt.Format("2006-01-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !observed.Balanced || observed.Summary.ConfirmedPayments != 3000 || observed.Summary.OpenSplitPayments != 3000 {
+		t.Fatalf("입금 관측일 대사 = %+v (불일치: %+v), want 3000원 결제가 맞음", observed.Summary, observed.Mismatches)
+	}
+
+	// 할당한 날: 주문 매출이 전날 결제로 설명되어 차이가 늘지 않음
+	after, err := buildReconciliation(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mismatch := range after.Mismatches {
+		if mismatch.OrderID == order.ID {
+			t.Fatalf("할당일 대사에 주문 불일치: %+v", mismatch)
+		}
+	}
+	if after.Summary.SalesDifference != before.Summary.SalesDifference ||
+		after.Summary.DepositDifference != before.Summary.DepositDifference {
+		t.Fatalf("할당일 대사 차이 = 매출 %d, 입금 %d, want 할당 전과 같음 (매출 %d, 입금 %d)",
+			after.Summary.SalesDifference, after.Summary.DepositDifference,
+			before.Summary.SalesDifference, before.Summary.DepositDifference)
+	}
+}
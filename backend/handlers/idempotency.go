@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 중복 요청 방지 (Idempotency-Key)
+// 키오스크가 네트워크 시간 초과 후 같은 요청을 다시 보내도 주문이나 결제가 두 번 생기지 않도록,
+// 클라이언트가 보낸 요청 키를 생성된 주문/결제에 저장하고 보관 기간 안에 같은 키로 다시 오면 처음 결과를 돌려줍니다.
+
+const (
+	IdempotencyKeyHeader        = "Idempotency-Key"
+	IdempotentReplayedHeader    = "Idempotent-Replayed" // 재전송된 요청에 처음 결과를 돌려줄 때 "true"
+	maxIdempotencyKeyLength     = 255
+	defaultIdempotencyRetention = 24 * time.Hour
+)
+
+// 요청 키 보관 기간 (지난 키는 새 요청으로 처리)
+var idempotencyRetention = defaultIdempotencyRetention
+
+// 같은 키의 주문 생성이 동시에 들어와도 주문이 하나만 생기도록 키별로 조회와 생성을 직렬화
+var orderKeyLocks = keyedMutex{locks: make(map[string]*keyLock)}
+
+// keyedMutex 요청 키별 잠금 (다른 키의 요청은 서로 기다리지 않음)
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int // 잠금을 잡았거나 기다리는 요청 수 (0이 되면 제거)
+}
+
+// Lock 키의 잠금을 잡고 해제 함수를 반환합니다
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// SetIdempotencyRetention 요청 키 보관 기간 설정
+func SetIdempotencyRetention(retention time.Duration) {
+	if retention > 0 {
+		idempotencyRetention = retention
+	}
+}
+
+// idempotencyCutoff 이 시각 이후에 생성된 주문/결제의 키만 재전송으로 봄
+func idempotencyCutoff() time.Time {
+	return time.Now().Add(-idempotencyRetention)
+}
+
+// requestIdempotencyKey Idempotency-Key 헤더 (없으면 본문의 요청 ID)
+func requestIdempotencyKey(c *gin.Context, requestID string) (string, error) {
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		key = requestID
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("요청 키가 너무 깁니다 (최대 %d자)", maxIdempotencyKeyLength)
+	}
+	return key, nil
+}
+
+// findIdempotentOrder 보관 기간 안에 같은 키로 생성된 주문
+func findIdempotentOrder(key string) (*models.Order, error) {
+	var orders []models.Order
+	if err := database.DB.Preload("OrderItems.Menu").
+		Where("idempotency_key = ? AND created_at >= ?", key, idempotencyCutoff()).
+		Order("id desc").Limit(1).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return &orders[0], nil
+}
+
+// sameOrderItems 재전송된 주문 요청이 처음 요청과 같은 메뉴/수량인지
+func sameOrderItems(order models.Order, items []models.OrderItemRequest) bool {
+	quantities := make(map[uint]int)
+	for _, item := range items {
+		quantities[item.MenuID] += item.Quantity
+	}
+	for _, item := range order.OrderItems {
+		quantities[item.MenuID] -= item.Quantity
+	}
+	for _, quantity := range quantities {
+		if quantity != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// PaymentReplayError 같은 요청 키로 이미 시작된 결제가 있음 (재전송된 결제 요청)
+type PaymentReplayError struct {
+	PaymentID string
+}
+
+func (e *PaymentReplayError) Error() string {
+	return fmt.Sprintf("이미 같은 요청으로 시작된 결제입니다 (결제 ID: %s)", e.PaymentID)
+}
+
+// findIdempotentPaymentLocked 같은 요청 키로 시작된 결제를 찾습니다 (activePaymentsMutex를 잡은 상태에서 호출)
+// 다른 주문의 결제에 쓰인 키이면 오류를 반환합니다.
+func findIdempotentPaymentLocked(key string, orderID uint) error {
+	for _, session := range activePayments {
+		if session.RequestID == key {
+			if session.OrderID != orderID {
+				return fmt.Errorf("다른 주문의 결제에 사용된 요청 키입니다")
+			}
+			return &PaymentReplayError{PaymentID: session.PaymentID}
+		}
+	}
+
+	var payments []models.Payment
+	if err := database.DB.Where("idempotency_key = ? AND started_at >= ?", key, idempotencyCutoff()).
+		Order("started_at desc").Limit(1).Find(&payments).Error; err != nil {
+		return err
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+	if payments[0].OrderID != orderID {
+		return fmt.Errorf("다른 주문의 결제에 사용된 요청 키입니다")
+	}
+	return &PaymentReplayError{PaymentID: payments[0].PaymentID}
+}
+
+// replayedPaymentInitiated 재전송된 결제 요청에 다시 보낼 payment_initiated 내용
+// 진행 중인 결제는 세션을, 이미 끝난 결제는 결제 기록을 기준으로 합니다 (세션이 없으면 nil).
+func replayedPaymentInitiated(paymentID string) (*PaymentSession, gin.H, error) {
+	if session := findPaymentSession(paymentID); session != nil {
+		return session, session.initiatedPayload(), nil
+	}
+
+	var payment models.Payment
+	if err := database.DB.Where("payment_id = ?", paymentID).First(&payment).Error; err != nil {
+		return nil, nil, fmt.Errorf("결제를 찾을 수 없습니다: %s", paymentID)
+	}
+	return nil, gin.H{
+		"payment_id":    payment.PaymentID,
+		"order_id":      payment.OrderID,
+		"amount":        payment.ExpectedAmount,
+		"order_amount":  payment.ExpectedAmount - payment.AmountOffset,
+		"amount_offset": payment.AmountOffset,
+		"qr_url":        fmt.Sprintf("/api/payments/%s/qr", payment.PaymentID),
+		"timestamp":     payment.StartedAt.Format(time.RFC3339),
+	}, nil
+}
+
+// resendPaymentStart 재전송된 결제 요청에 처음 결과(payment_initiated)를 다시 보내고,
+// 진행 중인 결제이면 구독하여 세션을 반환합니다. 이미 끝난 결제는 결과(payment_result)까지 보냅니다.
+func resendPaymentStart(sub sessionSubscriber, paymentID string) (*PaymentSession, error) {
+	session, payload, err := replayedPaymentInitiated(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil {
+		snapshot := session.subscribe(sub)
+		sub.send(MsgTypePaymentInitiated, payload)
+		if snapshot.Result == nil {
+			return session, nil
+		}
+		sub.send(MsgTypePaymentResult, *snapshot.Result)
+		return nil, nil
+	}
+
+	response, err := paymentResultFromRecord(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	sub.send(MsgTypePaymentInitiated, payload)
+	sub.send(MsgTypePaymentResult, response)
+	return nil, nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"kiosk/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetKISHealth KIS API 회로 차단기 상태와 마지막 예수금 조회 결과 (기본 계좌, accounts에 입금 계좌별 상태)
+func GetKISHealth(c *gin.Context) {
+	providerInterface, _ := c.Get("paymentProvider")
+	provider, ok := providerInterface.(utils.PaymentProvider)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "결제 제공자를 찾을 수 없습니다"})
+		return
+	}
+
+	accounts := provider.Accounts()
+	primary := accounts[0]
+	if primary.Health == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "KIS 결제 제공자가 활성화되어 있지 않습니다 (PAYMENT_PROVIDER=kis)"})
+		return
+	}
+
+	degraded := false
+	for _, account := range accounts {
+		degraded = degraded || account.Degraded
+	}
+	response := gin.H{
+		"health":          primary.Health,
+		"degraded":        degraded,
+		"current_deposit": primary.Balance,
+		"accounts":        accounts,
+	}
+	if primary.LastPollError != "" {
+		response["last_poll_error"] = primary.LastPollError
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetKISStatus 현재 사용 중인 KIS 환경 (실전/모의/사용자 지정), 주소, tr_id, 계좌, 토큰 만료 시각
+func GetKISStatus(c *gin.Context) {
+	kisApiInterface, _ := c.Get("kisApi")
+	kisApi, ok := kisApiInterface.(*utils.KISApi)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "KIS 결제 제공자가 활성화되어 있지 않습니다 (PAYMENT_PROVIDER=kis)"})
+		return
+	}
+
+	c.JSON(http.StatusOK, kisApi.Status())
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"kiosk/database"
 	"kiosk/models"
+	"kiosk/utils"
 	"net/http"
 	"strconv"
 	"sync"
@@ -52,7 +54,14 @@ func StartSSEBroadcaster() {
 
 func GetOrders(c *gin.Context) {
     var orders []models.Order
-    if err := database.DB.Preload("OrderItems.Menu").Find(&orders).Error; err != nil {
+    query := database.DB.Preload("OrderItems.Menu")
+
+    // 상태별 필터링 (옵션)
+    if status := c.Query("status"); status != "" {
+        query = query.Where("status = ?", status)
+    }
+
+    if err := query.Find(&orders).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
@@ -107,6 +116,21 @@ func GetOrdersByPeriod(c *gin.Context) {
     
     // 기본 쿼리 설정
     query := database.DB.Preload("OrderItems.Menu").Where("orders.created_at BETWEEN ? AND ?", start, end)
+
+    // 주문 상태 필터 (기본값: 결제 완료된 주문만, all이면 전체)
+    status := c.DefaultQuery("status", models.OrderStatusPaid)
+    if status != "all" {
+        query = query.Where("orders.status = ?", status)
+    }
+
+    // 결제 수단 필터 (결제 수단이 없는 주문은 계좌 이체)
+    if method := c.Query("payment_method"); method != "" {
+        if method == models.PaymentMethodTransfer {
+            query = query.Where("orders.payment_method IN ?", []string{models.PaymentMethodTransfer, ""})
+        } else {
+            query = query.Where("orders.payment_method = ?", method)
+        }
+    }
     
     // 금액 범위 필터 적용
     if minAmount != "" {
@@ -200,9 +224,9 @@ func OrdersEventStream(c *gin.Context) {
 		clientsMutex.Unlock()
 	}()
 	
-	// 초기 데이터 전송 - 현재 모든 주문
+	// 초기 데이터 전송 - 결제 완료된 주문만 (결제 대기 주문은 주방에 노출하지 않음)
 	var orders []models.Order
-	if err := database.DB.Preload("OrderItems.Menu").Find(&orders).Error; err == nil {
+	if err := database.DB.Preload("OrderItems.Menu").Where("status = ?", models.OrderStatusPaid).Find(&orders).Error; err == nil {
 		for _, order := range orders {
 			data, _ := json.Marshal(order)
 			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
@@ -237,6 +261,33 @@ func CreateOrder(c *gin.Context) {
         return
     }
 
+    // 중복 요청 방지 - 같은 키로 이미 생성된 주문이 있으면 그 주문을 돌려줌
+    key, err := requestIdempotencyKey(c, req.RequestID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if key != "" {
+        unlock := orderKeyLocks.Lock(key)
+        defer unlock()
+
+        existing, err := findIdempotentOrder(key)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if existing != nil {
+            if !sameOrderItems(*existing, req.Items) {
+                c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "같은 요청 키로 다른 주문이 이미 생성되었습니다"})
+                return
+            }
+            logMessage("중복 주문 요청 - 기존 주문 반환, 주문 ID: %d, 요청 키: %s", existing.ID, key)
+            c.Header(IdempotentReplayedHeader, "true")
+            c.JSON(http.StatusCreated, existing)
+            return
+        }
+    }
+
     // 트랜잭션 시작
     tx := database.DB.Begin()
     defer func() {
@@ -267,9 +318,11 @@ func CreateOrder(c *gin.Context) {
         totalPrice += menu.Price * item.Quantity
     }
 
-    // 총액이 계산된 후 주문 생성
+    // 총액이 계산된 후 주문 생성 (결제 확인 전까지는 결제 대기 상태)
     order := models.Order{
-        TotalPrice: totalPrice,
+        TotalPrice:     totalPrice,
+        Status:         models.OrderStatusPendingPayment,
+        IdempotencyKey: key,
     }
     if err := tx.Create(&order).Error; err != nil {
         tx.Rollback()
@@ -302,9 +355,7 @@ func CreateOrder(c *gin.Context) {
         return
     }
 
-    // 새 주문을 모든 연결된 클라이언트에게 브로드캐스트
-    broadcaster <- completeOrder
-
+    // 결제 대기 주문은 결제가 확인된 후에 브로드캐스트됨 (markOrderPaid)
     c.JSON(http.StatusCreated, completeOrder)
 }
 
@@ -319,15 +370,45 @@ func DeleteOrder(c *gin.Context) {
         return
     }
 
+    // 결제 완료된 주문은 삭제하지 않고 취소 처리하여 환불 기록을 남김
+    if order.PaidAt != nil {
+        c.JSON(http.StatusConflict, gin.H{"error": "결제된 주문은 삭제할 수 없습니다. POST /api/admin/orders/:id/cancel 로 취소하고 환불을 등록하세요"})
+        return
+    }
+
+    // 확인하는 동안 결제가 시작되지 않도록 잡아둠
+    activePaymentsMutex.Lock()
+    defer activePaymentsMutex.Unlock()
+
+    // 결제가 진행 중인 주문은 결제 취소로 처리해야 함
+    if paymentID, ok := activeOrderPayments[order.ID]; ok {
+        c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("결제가 진행 중인 주문입니다 (결제 ID: %s)", paymentID)})
+        return
+    }
+
+    // 분할 결제로 일부 결제된 주문은 받은 금액을 환불해야 하므로 취소 처리
+    paid, _, err := orderPaidLegs(order.ID, "")
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if paid > 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("일부 결제된 주문(%s원)은 삭제할 수 없습니다. POST /api/admin/orders/:id/cancel 로 취소하고 환불을 등록하세요",
+            utils.FormatNumber(paid))})
+        return
+    }
+
     // 주문 삭제
     if err := database.DB.Delete(&order).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
-    // SSE 브로드캐스트를 위한 빈 주문 객체 생성
-    emptyOrder := models.Order{ID: order.ID}
-    broadcaster <- emptyOrder
+    // SSE 브로드캐스트를 위한 빈 주문 객체 생성 (주방에 노출된 주문만)
+    if order.Status == models.OrderStatusPaid {
+        emptyOrder := models.Order{ID: order.ID}
+        broadcaster <- emptyOrder
+    }
 
     c.JSON(http.StatusOK, gin.H{"message": "Order deleted successfully"})
 }
@@ -356,4 +437,60 @@ func UpdateOrder(c *gin.Context) {
     broadcaster <- order
     
     c.JSON(http.StatusOK, order)
+}
+
+// ErrInvalidOrderTransition 허용되지 않는 주문 상태 전이
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// transitionOrderStatus 주문 상태를 전이합니다.
+// 현재 상태가 to로 전이할 수 없는 상태이면 ErrInvalidOrderTransition을 반환합니다.
+// 조건부 UPDATE로 처리하므로 동시에 여러 곳에서 호출되어도 한 번만 성공합니다.
+func transitionOrderStatus(orderID uint, to string) (models.Order, error) {
+    return transitionOrderStatusWith(orderID, to, nil)
+}
+
+// transitionOrderStatusWith 주문 상태 전이와 함께 다른 필드도 변경합니다
+func transitionOrderStatusWith(orderID uint, to string, extra map[string]interface{}) (models.Order, error) {
+    var order models.Order
+    if err := database.DB.First(&order, orderID).Error; err != nil {
+        return order, err
+    }
+
+    if !models.CanTransitionOrder(order.Status, to) {
+        return order, fmt.Errorf("%w: %s -> %s", ErrInvalidOrderTransition, order.Status, to)
+    }
+
+    updates := map[string]interface{}{"status": to}
+    if to == models.OrderStatusPaid {
+        updates["paid_at"] = time.Now()
+    }
+    for key, value := range extra {
+        updates[key] = value
+    }
+
+    result := database.DB.Model(&models.Order{}).
+        Where("id = ? AND status IN ?", orderID, models.OrderStatusesFrom(to)).
+        Updates(updates)
+    if result.Error != nil {
+        return order, result.Error
+    }
+    if result.RowsAffected == 0 {
+        return order, fmt.Errorf("%w: 주문 %d의 상태가 변경되었습니다", ErrInvalidOrderTransition, orderID)
+    }
+
+    if err := database.DB.Preload("OrderItems.Menu").First(&order, orderID).Error; err != nil {
+        return order, err
+    }
+    return order, nil
+}
+
+// markOrderPaid 주문을 결제 완료 상태로 전환하고 주방(SSE)에 브로드캐스트합니다
+func markOrderPaid(orderID uint, method string) (models.Order, error) {
+    order, err := transitionOrderStatusWith(orderID, models.OrderStatusPaid, map[string]interface{}{"payment_method": method})
+    if err != nil {
+        return order, err
+    }
+
+    broadcaster <- order
+    return order, nil
 }
\ No newline at end of file
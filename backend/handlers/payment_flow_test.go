@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"kiosk/database"
+	"kiosk/fakekis"
+	"kiosk/models"
+	"kiosk/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const flowTestAccount = "12345678"
+
+// TestMain 임시 디렉토리의 DB와 결제 로그로 테스트를 실행합니다
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "kiosk-handlers-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	if err := database.InitDB(); err != nil {
+		log.Fatal(err)
+	}
+	if err := InitLogSystem(0); err != nil {
+		log.Fatal(err)
+	}
+	// 결제 완료된 주문은 주방 화면으로 전달되므로 main과 같이 브로드캐스터를 시작
+	StartSSEBroadcaster()
+	gin.SetMode(gin.TestMode)
+
+	code := m.Run()
+	CloseLogSystem()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// paymentFlow 가짜 KIS 서버의 예수금을 감시하는 결제 제공자와 결제 웹소켓 서버
+type paymentFlow struct {
+	kis   *fakekis.Server
+	wsURL string
+}
+
+func newPaymentFlow(t *testing.T) *paymentFlow {
+	t.Helper()
+	kis := fakekis.New(fakekis.Config{InitialBalance: 100000})
+	kisServer := httptest.NewServer(kis)
+	t.Cleanup(kisServer.Close)
+
+	config := utils.DefaultKISConfig(utils.KISEnvCustom)
+	config.BaseURL = kisServer.URL
+	config.AppKey, config.AppSecret, config.AccountNo = "key", "secret", flowTestAccount
+	config.RateLimit = 0
+	if err := config.Validate(); err != nil {
+		t.Fatalf("KIS 설정 검증 실패: %v", err)
+	}
+	api := utils.NewKISApiFromConfig(config)
+
+	provider := utils.NewDepositProvider(utils.ProviderKIS,
+		utils.NewDepositAccount(config.AccountID(), config.MaskedAccount(), api))
+	if err := provider.Initialize(); err != nil {
+		t.Fatalf("예수금 상태 초기화 실패: %v", err)
+	}
+	provider.SetPollInterval(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	provider.StartPolling(ctx)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("paymentProvider", utils.PaymentProvider(provider))
+		c.Next()
+	})
+	r.GET("/ws/payment", PaymentHandler)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return &paymentFlow{kis: kis, wsURL: "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/payment"}
+}
+
+// dial 결제 웹소켓 연결
+func (f *paymentFlow) dial(t *testing.T) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(f.wsURL, nil)
+	if err != nil {
+		t.Fatalf("웹소켓 연결 실패: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// createPendingOrder 결제 대기 중인 주문 생성
+func createPendingOrder(t *testing.T, totalPrice int) models.Order {
+	t.Helper()
+	order := models.Order{TotalPrice: totalPrice, Status: models.OrderStatusPendingPayment}
+	if err := database.DB.Create(&order).Error; err != nil {
+		t.Fatalf("주문 생성 실패: %v", err)
+	}
+	return order
+}
+
+// wsMessage 받은 웹소켓 메시지 (payload는 필요한 타입으로 다시 디코딩)
+type wsMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, msgType string, payload interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(WebSocketMessage{Type: msgType, Payload: payload}); err != nil {
+		t.Fatalf("%s 전송 실패: %v", msgType, err)
+	}
+}
+
+// readUntil msgType 메시지를 받을 때까지 읽고 payload를 out에 디코딩합니다 (error 메시지는 실패)
+func readUntil(t *testing.T, conn *websocket.Conn, msgType string, out interface{}) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("%s 메시지를 기다리는 중 읽기 실패: %v", msgType, err)
+		}
+		if msg.Type == MsgTypeError {
+			t.Fatalf("%s 메시지 대신 오류 수신: %s", msgType, msg.Payload)
+		}
+		if msg.Type != msgType {
+			continue
+		}
+		if err := json.Unmarshal(msg.Payload, out); err != nil {
+			t.Fatalf("%s 메시지 해석 실패: %v", msgType, err)
+		}
+		return
+	}
+}
+
+// paymentInitiated payment_initiated 메시지 내용
+type paymentInitiated struct {
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+}
+
+func TestPaymentFlowSucceedsOnDeposit(t *testing.T) {
+	flow := newPaymentFlow(t)
+	order := createPendingOrder(t, 3000)
+	conn := flow.dial(t)
+
+	sendWS(t, conn, MsgTypePaymentRequest, models.PaymentRequest{OrderID: order.ID})
+	var initiated paymentInitiated
+	readUntil(t, conn, MsgTypePaymentInitiated, &initiated)
+	if initiated.Amount != 3000 {
+		t.Fatalf("결제 요청 금액 = %d, want 3000", initiated.Amount)
+	}
+
+	// 고객이 요청 금액을 입금함
+	flow.kis.Deposit(flowTestAccount, initiated.Amount)
+
+	var result models.PaymentResponse
+	readUntil(t, conn, MsgTypePaymentResult, &result)
+	if !result.Success {
+		t.Fatalf("결제 실패: %s", result.Message)
+	}
+
+	var saved models.Order
+	database.DB.First(&saved, order.ID)
+	if saved.Status != models.OrderStatusPaid || saved.PaidAt == nil {
+		t.Fatalf("주문 상태 = %s (paid_at: %v), want paid", saved.Status, saved.PaidAt)
+	}
+	var payment models.Payment
+	database.DB.Where("payment_id = ?", initiated.PaymentID).First(&payment)
+	if payment.Status != models.PaymentStatusSucceeded || payment.ActualChange != 3000 {
+		t.Fatalf("결제 기록 = %s (입금액 %d), want succeeded (3000)", payment.Status, payment.ActualChange)
+	}
+}
+
+func TestPaymentFlowCancelAfterUnderpaymentRefunds(t *testing.T) {
+	flow := newPaymentFlow(t)
+	order := createPendingOrder(t, 5000)
+	conn := flow.dial(t)
+
+	sendWS(t, conn, MsgTypePaymentRequest, models.PaymentRequest{OrderID: order.ID})
+	var initiated paymentInitiated
+	readUntil(t, conn, MsgTypePaymentInitiated, &initiated)
+
+	// 일부만 입금된 뒤 고객이 취소함
+	flow.kis.Deposit(flowTestAccount, 3000)
+	var underpaid map[string]interface{}
+	readUntil(t, conn, MsgTypePaymentUnderpaid, &underpaid)
+
+	sendWS(t, conn, MsgTypeCancelRequest, CancelRequest{PaymentID: initiated.PaymentID})
+	var result models.PaymentResponse
+	readUntil(t, conn, MsgTypePaymentResult, &result)
+	if result.Success {
+		t.Fatal("취소한 결제가 성공으로 끝남")
+	}
+
+	var payment models.Payment
+	database.DB.Where("payment_id = ?", initiated.PaymentID).First(&payment)
+	if payment.Status != models.PaymentStatusUnderpaid || payment.RefundDue != 3000 {
+		t.Fatalf("결제 기록 = %s (환불 필요 %d), want underpaid (3000)", payment.Status, payment.RefundDue)
+	}
+	var saved models.Order
+	database.DB.First(&saved, order.ID)
+	if saved.Status != models.OrderStatusCancelled {
+		t.Fatalf("주문 상태 = %s, want cancelled", saved.Status)
+	}
+}
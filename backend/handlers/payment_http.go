@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTP 롱폴링 최대 대기 시간 (프록시의 요청 제한 시간보다 짧게)
+const maxPaymentPollWait = 60 * time.Second
+
+// PaymentPollResponse HTTP 롱폴링 응답 - 세션 상태와 since 이후의 메시지 (웹소켓과 같은 type/payload)
+type PaymentPollResponse struct {
+	PaymentSessionSnapshot
+	Events []SessionEvent `json:"events"`
+	Done   bool           `json:"done"` // 최종 결과가 나옴 (result 참고)
+}
+
+// StartPayment 웹소켓 없이 결제 세션을 시작합니다 (웹소켓의 payment_request와 같은 세션)
+// 응답은 payment_initiated 메시지와 같고, 이후 상태는 GET /api/payments/:id?wait=30s 로 받습니다.
+// Idempotency-Key 헤더(또는 request_id)로 다시 보낸 요청에는 처음 시작된 결제를 돌려줍니다.
+func StartPayment(c *gin.Context) {
+	provider, ok := c.MustGet("paymentProvider").(utils.PaymentProvider)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid payment provider type"})
+		return
+	}
+
+	var req models.PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := requestIdempotencyKey(c, req.RequestID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.RequestID = key
+
+	session, err := startPaymentSession(provider, req, nil)
+	var replay *PaymentReplayError
+	if errors.As(err, &replay) {
+		// 재전송된 요청 - 처음 시작된 결제를 돌려줌 (이후 상태는 롱폴링으로)
+		logMessage("중복 결제 요청 - 기존 결제 반환, 결제 ID: %s, 요청 키: %s", replay.PaymentID, key)
+		session, payload, err := replayedPaymentInitiated(replay.PaymentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if session != nil {
+			payload["version"] = session.Snapshot().Version
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		c.JSON(http.StatusCreated, payload)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload := session.initiatedPayload()
+	payload["version"] = session.Snapshot().Version
+	c.JSON(http.StatusCreated, payload)
+}
+
+// CancelPaymentSession 진행 중인 결제 취소 (웹소켓의 cancel_request와 같음)
+// 취소 결과(payment_result)는 롱폴링으로 받습니다.
+func CancelPaymentSession(c *gin.Context) {
+	paymentID := c.Param("id")
+	if !cancelPayment(paymentID) {
+		logMessage("결제 취소 실패 - 결제 ID: %s (존재하지 않거나 이미 완료됨)", paymentID)
+		c.JSON(http.StatusConflict, gin.H{
+			"success":    false,
+			"payment_id": paymentID,
+			"message":    "취소할 결제를 찾을 수 없거나 이미 완료된 결제입니다",
+		})
+		return
+	}
+
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventCancelRequested, PaymentID: paymentID}, "결제 취소 처리 완료 - 결제 ID: %s", paymentID)
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"payment_id": paymentID,
+		"message":    "결제가 성공적으로 취소되었습니다",
+	})
+}
+
+// pollPayment 결제 세션의 다음 상태 변화를 기다립니다 (GET /api/payments/:id?wait=30s&since=버전)
+// since보다 새로운 메시지가 있으면 바로, 없으면 다음 메시지나 최종 결과가 나올 때까지 wait 동안 기다립니다.
+func pollPayment(c *gin.Context, paymentID string) {
+	wait, err := time.ParseDuration(c.Query("wait"))
+	if err != nil || wait < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 대기 시간입니다 (예: wait=30s)"})
+		return
+	}
+	if wait > maxPaymentPollWait {
+		wait = maxPaymentPollWait
+	}
+	var since uint64
+	if value := c.Query("since"); value != "" {
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 since 값입니다"})
+			return
+		}
+	}
+
+	if session := findPaymentSession(paymentID); session != nil {
+		snapshot, events := session.waitForChange(c.Request.Context(), since, wait)
+		c.JSON(http.StatusOK, PaymentPollResponse{
+			PaymentSessionSnapshot: snapshot,
+			Events:                 events,
+			Done:                   snapshot.Result != nil,
+		})
+		return
+	}
+
+	// 이미 끝난 결제 - 저장된 기록으로 결과 전송
+	var payment models.Payment
+	if err := database.DB.Where("payment_id = ?", paymentID).First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	result, err := paymentResultFromRecord(paymentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, PaymentPollResponse{
+		PaymentSessionSnapshot: PaymentSessionSnapshot{
+			PaymentID:   payment.PaymentID,
+			OrderID:     payment.OrderID,
+			Amount:      payment.ExpectedAmount,
+			OrderAmount: payment.ExpectedAmount - payment.AmountOffset,
+			Received:    payment.ActualChange,
+			Provider:    payment.Provider,
+			Account:     payment.Account,
+			StartedAt:   payment.StartedAt,
+			Status:      payment.Status,
+			Attempt:     payment.Attempts,
+			Result:      &result,
+		},
+		Events: []SessionEvent{},
+		Done:   true,
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 결제 로그 이벤트 종류
+const (
+	PaymentEventMessage          = "message"          // 결제와 직접 관련 없는 기록
+	PaymentEventError            = "error"            // 기록 실패 등 오류
+	PaymentEventStarted          = "payment_started"  // 입금 대기 시작
+	PaymentEventCancelRequested  = "cancel_requested" // 고객 취소 요청
+	PaymentEventDepositMatched   = "deposit_matched"  // 입금이 결제에 할당됨 (부족/초과 포함)
+	PaymentEventFinished         = "payment_finished" // 결제 종료 (status에 결과)
+	PaymentEventRecovered        = "payment_recovered"
+	PaymentEventResumed          = "payment_resumed"
+	PaymentEventReview           = "payment_review"   // 직원 확인 필요
+	PaymentEventOverride         = "payment_override" // 직원이 진행 중인 결제를 강제 성공/실패 처리
+	PaymentEventDepositUnmatched = "deposit_unmatched"
+	PaymentEventDepositAssigned  = "deposit_assigned"
+	PaymentEventDepositDismissed = "deposit_dismissed"
+	PaymentEventCounterPayment   = "counter_payment"
+	PaymentEventSplitPayment     = "split_payment" // 분할 결제 중 일부 결제 확인 (주문은 결제 대기 유지)
+	PaymentEventRefundCreated    = "refund_created"
+	PaymentEventRefundCompleted  = "refund_completed"
+	PaymentEventOrderCancelled   = "order_cancelled"
+	PaymentEventSimulator        = "simulator_deposit"
+)
+
+// 결제 로그 (날짜별 JSON Lines 파일)
+var paymentLog *utils.PaymentLog
+
+// InitLogSystem 결제 로그 초기화 (logs/payment_YYYY-MM-DD.jsonl, retentionDays가 지난 파일은 삭제)
+func InitLogSystem(retentionDays int) error {
+	l, err := utils.NewPaymentLog("logs", retentionDays)
+	if err != nil {
+		return err
+	}
+	paymentLog = l
+	logMessage("결제 로그 시스템 초기화 완료")
+	return nil
+}
+
+// CloseLogSystem 결제 로그 종료
+func CloseLogSystem() {
+	if paymentLog != nil {
+		paymentLog.Close()
+	}
+}
+
+// logMessage 결제와 직접 관련 없는 메시지 기록 (콘솔과 결제 로그)
+func logMessage(format string, args ...interface{}) {
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventMessage}, format, args...)
+}
+
+// logPaymentEvent 결제 이벤트 기록 - 메시지는 콘솔에도 출력됩니다
+func logPaymentEvent(event utils.PaymentLogEvent, format string, args ...interface{}) {
+	event.Message = fmt.Sprintf(format, args...)
+	log.Println(event.Message) // 콘솔에 출력
+
+	if paymentLog != nil {
+		if err := paymentLog.Write(event); err != nil {
+			log.Printf("결제 로그 기록 실패: %v", err)
+		}
+	}
+}
+
+// depositValue 결제 로그의 예수금 값 (0원도 기록되도록 포인터로 전달)
+func depositValue(amount int64) *int64 {
+	return &amount
+}
+
+// GetPaymentLogs 결제 로그 검색 (날짜를 지정하지 않으면 결제/주문 조건이 있을 때 보관 중인 모든 날짜, 없으면 오늘)
+func GetPaymentLogs(c *gin.Context) {
+	if paymentLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "결제 로그가 초기화되지 않았습니다"})
+		return
+	}
+
+	filter := utils.PaymentLogFilter{
+		Date:      c.Query("date"),
+		PaymentID: c.Query("payment_id"),
+		Type:      c.Query("type"),
+		Level:     c.Query("level"),
+	}
+	if filter.Date != "" {
+		if _, err := time.Parse("2006-01-02", filter.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 날짜 형식. YYYY-MM-DD 형식을 사용하세요"})
+			return
+		}
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		id, err := strconv.ParseUint(orderID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 주문 ID입니다"})
+			return
+		}
+		filter.OrderID = uint(id)
+	}
+
+	events, err := paymentLog.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":       filter.Date,
+		"payment_id": filter.PaymentID,
+		"count":      len(events),
+		"events":     events,
+	})
+}
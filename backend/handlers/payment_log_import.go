@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"time"
+)
+
+// LegacyImportSummary 기존 텍스트 결제 로그 가져오기 결과
+type LegacyImportSummary struct {
+	Files            int `json:"files"`
+	Entries          int `json:"entries"`           // 알아본 결제/예수금 기록 줄 수
+	UnrecognizedRows int `json:"unrecognized_rows"` // 결제와 무관하거나 알아볼 수 없는 줄 (웹소켓 오류, 초기화 메시지 등)
+	Payments         int `json:"payments"`          // 새로 저장한 결제 기록
+	DepositWarnings  int `json:"deposit_warnings"`  // 예수금 불일치 경고 (예수금 변동으로 저장하지 않음)
+	AlreadyImported  int `json:"already_imported"`  // 이전에 가져온 기록 (건너뜀)
+}
+
+// legacyPayment 기존 로그의 여러 줄을 모아 다시 만든 결제 세션
+type legacyPayment struct {
+	payment models.Payment
+	first   utils.LegacyLogEntry // 결제 ID가 같은 첫 기록 (출처 표시용)
+}
+
+// ImportLegacyPaymentLogs 구조화된 결제 로그 이전의 텍스트 로그(dir/payment_YYYY-MM-DD.log)를 읽어
+// 시간 초과, 금액 불일치, 취소된 결제를 결제 기록으로 저장합니다.
+// 성공한 결제는 기존 로그 파일에 남지 않았으므로 초과 입금으로 끝난 결제만 성공으로 복원되며,
+// 주문 ID를 알 수 없어 결제 기록의 주문은 비어 있습니다. 다시 실행해도 이미 가져온 기록은 건너뜁니다.
+// 예수금 불일치 경고는 실제 입출금 금액이 아니므로 예수금 변동(직원 확인 대기열)으로 만들지 않고,
+// 결제 ID가 있는 경고만 해당 결제 기록의 메모에 남깁니다.
+func ImportLegacyPaymentLogs(dir string, dryRun bool) (LegacyImportSummary, error) {
+	var summary LegacyImportSummary
+
+	files, err := utils.LegacyPaymentLogFiles(dir)
+	if err != nil {
+		return summary, fmt.Errorf("로그 디렉토리를 읽을 수 없습니다: %v", err)
+	}
+
+	var payments []*legacyPayment
+	byID := make(map[string]*legacyPayment)
+	warnings := make(map[string][]utils.LegacyLogEntry) // 결제 ID별 예수금 불일치 경고
+
+	for _, file := range files {
+		entries, unrecognized, err := utils.ParseLegacyPaymentLog(file)
+		if err != nil {
+			return summary, fmt.Errorf("%s: %v", file, err)
+		}
+		summary.Files++
+		summary.Entries += len(entries)
+		summary.UnrecognizedRows += unrecognized
+
+		for _, entry := range entries {
+			switch entry.Kind {
+			case utils.LegacyDepositMismatch:
+				summary.DepositWarnings++
+				continue
+			case utils.LegacyDepositDrift:
+				summary.DepositWarnings++
+				warnings[entry.PaymentID] = append(warnings[entry.PaymentID], entry)
+				continue
+			}
+
+			// 결제 ID가 없는 오래된 형식은 줄마다 별개의 결제
+			paymentID := entry.PaymentID
+			if paymentID == "" {
+				paymentID = fmt.Sprintf("legacy-%s-%d", entry.Time.Format("20060102-150405"), entry.Line)
+			}
+			lp, ok := byID[paymentID]
+			if !ok {
+				lp = &legacyPayment{first: entry, payment: models.Payment{
+					PaymentID: paymentID,
+					Provider:  utils.ProviderKIS,
+					Method:    models.PaymentMethodTransfer,
+					StartedAt: entry.Time,
+					Note:      fmt.Sprintf("기존 로그에서 가져옴 (%s:%d)", entry.File, entry.Line),
+				}}
+				byID[paymentID] = lp
+				payments = append(payments, lp)
+			}
+			applyLegacyEntry(&lp.payment, entry)
+		}
+	}
+
+	for _, lp := range payments {
+		noteLegacyDepositWarnings(&lp.payment, warnings[lp.payment.PaymentID])
+
+		var count int64
+		if err := database.DB.Model(&models.Payment{}).Where("payment_id = ?", lp.payment.PaymentID).Count(&count).Error; err != nil {
+			return summary, fmt.Errorf("결제 기록 조회 실패 (%s): %v", lp.payment.PaymentID, err)
+		}
+		if count > 0 {
+			summary.AlreadyImported++
+			continue
+		}
+		if !dryRun {
+			if err := database.DB.Create(&lp.payment).Error; err != nil {
+				return summary, fmt.Errorf("결제 기록 저장 실패 (%s:%d): %v", lp.first.File, lp.first.Line, err)
+			}
+		}
+		summary.Payments++
+	}
+	return summary, nil
+}
+
+// applyLegacyEntry 기존 로그 한 줄을 결제 기록에 반영합니다 (같은 결제의 나중 기록이 결과를 덮어씀)
+func applyLegacyEntry(payment *models.Payment, entry utils.LegacyLogEntry) {
+	finishedAt := entry.Time
+	payment.FinishedAt = &finishedAt
+	if entry.Expected > 0 {
+		payment.ExpectedAmount = entry.Expected
+	}
+
+	// 시작 시각은 남아 있지 않으므로 걸린 시간(또는 1초 간격이던 시도 횟수)으로 추정
+	elapsed := entry.Elapsed
+	if elapsed == 0 && entry.Attempt > 0 {
+		elapsed = time.Duration(entry.Attempt) * time.Second
+		payment.Attempts = entry.Attempt
+	}
+	if started := entry.Time.Add(-elapsed); started.Before(payment.StartedAt) {
+		payment.StartedAt = started
+	}
+
+	switch entry.Kind {
+	case utils.LegacyPaymentTimeout:
+		payment.Status = models.PaymentStatusTimeout
+		payment.ActualChange = entry.Change
+		payment.CancelReason = "결제 확인 시간 초과"
+		if entry.Change > 0 && entry.Change < entry.Expected {
+			payment.Status = models.PaymentStatusUnderpaid
+			payment.RefundDue = entry.Change
+			payment.CancelReason = fmt.Sprintf("부족 입금 후 시간 초과 (환불 필요: %s원)", utils.FormatNumber(entry.Change))
+		}
+
+	case utils.LegacyPaymentMismatch:
+		// 시도마다 남는 중간 기록 - 이후 입금으로 성공했을 수도 있으므로 결과는 뒤따르는 기록으로 정해지고,
+		// 뒤따르는 기록이 없으면 직원 확인이 필요
+		payment.Status = models.PaymentStatusReview
+		payment.ActualChange = entry.Change
+		payment.CancelReason = fmt.Sprintf("시도 중 입금액 불일치 후 결과가 로그에 남지 않음 (요청 금액: %s원, 예수금 변동: %s원)",
+			utils.FormatNumber(entry.Expected), utils.FormatNumber(entry.Change))
+
+	case utils.LegacyPaymentCancelled:
+		// 취소 처리 완료와 취소 요청 수신이 함께 남으므로 먼저 기록된 결과를 유지
+		if payment.Status == models.PaymentStatusCancelled || payment.Status == models.PaymentStatusUnderpaid {
+			return
+		}
+		payment.Status = models.PaymentStatusCancelled
+		payment.CancelReason = "사용자 요청에 의한 취소"
+		if payment.ActualChange > 0 {
+			payment.Status = models.PaymentStatusUnderpaid
+			payment.RefundDue = payment.ActualChange
+			payment.CancelReason = fmt.Sprintf("부족 입금 후 사용자 취소 (환불 필요: %s원)", utils.FormatNumber(payment.ActualChange))
+		}
+
+	case utils.LegacyPaymentUnderpaid:
+		// 중간 기록 - 결과는 뒤따르는 시간 초과/취소 기록으로 정해짐
+		payment.ActualChange = entry.Change
+		if payment.Status == "" {
+			payment.Status = models.PaymentStatusReview
+			payment.CancelReason = "부족 입금 후 결과가 로그에 남지 않음"
+		}
+
+	case utils.LegacyPaymentOverpaid:
+		payment.Status = models.PaymentStatusSucceeded
+		payment.ActualChange = entry.Change
+		payment.RefundDue = entry.Surplus
+		payment.CancelReason = ""
+	}
+}
+
+// noteLegacyDepositWarnings 결제 확인 중 남은 예수금 불일치 경고를 결제 기록의 메모에 덧붙입니다
+func noteLegacyDepositWarnings(payment *models.Payment, warnings []utils.LegacyLogEntry) {
+	if len(warnings) == 0 {
+		return
+	}
+	var difference int64
+	for _, warning := range warnings {
+		difference += warning.Difference
+	}
+	payment.Note += fmt.Sprintf(", 확인 중 예수금 불일치 경고 %d건 (차이 합계: %s원)",
+		len(warnings), utils.FormatNumber(difference))
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paymentOverrideWait 강제 처리 후 결제 세션이 결과를 저장할 때까지 기다리는 최대 시간
+const paymentOverrideWait = 5 * time.Second
+
+// PaymentOverrideRequest 진행 중인 결제의 강제 성공/실패 처리 요청
+type PaymentOverrideRequest struct {
+	Status       string `json:"status" binding:"required,oneof=succeeded failed"`
+	Reason       string `json:"reason" binding:"required"`
+	OverriddenBy string `json:"overridden_by"`
+}
+
+// paymentOverride 결제 세션에 전달되는 직원 처리 내용
+type paymentOverride struct {
+	Status string
+	Reason string
+	By     string
+}
+
+// resultWaiter 결제 세션의 최종 결과를 기다리는 구독자
+type resultWaiter chan models.PaymentResponse
+
+// send 최종 결과만 전달합니다 (결제 세션 구독자 인터페이스 구현)
+func (w resultWaiter) send(msgType string, payload interface{}) error {
+	if result, ok := payload.(models.PaymentResponse); ok && msgType == MsgTypePaymentResult {
+		select {
+		case w <- result:
+		default:
+		}
+	}
+	return nil
+}
+
+// overridePayment 진행 중인 결제 세션에 직원 처리를 전달합니다 (세션이 없거나 이미 끝났으면 false)
+func overridePayment(session *PaymentSession, override paymentOverride) bool {
+	session.mu.Lock()
+	finished := session.result != nil
+	session.mu.Unlock()
+	if finished {
+		return false
+	}
+
+	select {
+	case session.overrideChan <- override:
+		return true
+	default:
+		return false // 이미 다른 직원 처리가 전달됨
+	}
+}
+
+// recordPaymentOverride 결제 기록에 직원 처리 내용을 남깁니다 (결과는 finishPaymentRecord가 저장)
+func recordPaymentOverride(paymentID string, override paymentOverride) {
+	now := time.Now()
+	err := database.DB.Model(&models.Payment{}).
+		Where("payment_id = ?", paymentID).
+		Updates(map[string]interface{}{
+			"overridden_by":   override.By,
+			"overridden_at":   &now,
+			"override_reason": override.Reason,
+		}).Error
+	if err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, Status: override.Status},
+			"[중요] 결제 직원 처리 기록 실패 - ID: %s, 오류: %v", paymentID, err)
+	}
+}
+
+// GetActivePayments 진행 중인 결제 세션 목록 (오래된 순)
+func GetActivePayments(c *gin.Context) {
+	activePaymentsMutex.Lock()
+	sessions := make([]*PaymentSession, 0, len(activePayments))
+	for _, session := range activePayments {
+		sessions = append(sessions, session)
+	}
+	activePaymentsMutex.Unlock()
+
+	snapshots := make([]PaymentSessionSnapshot, 0, len(sessions))
+	for _, session := range sessions {
+		snapshots = append(snapshots, session.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].StartedAt.Before(snapshots[j].StartedAt)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    len(snapshots),
+		"payments": snapshots,
+	})
+}
+
+// OverridePayment 입금 확인이 누락된 결제(은행 지연, 금액 충돌 등)를 직원이 강제로 성공 또는 실패 처리합니다.
+// 키오스크는 웹소켓으로 일반 payment_result를 받고, 결제 기록에는 처리한 직원과 사유가 남아 대사 리포트에 표시됩니다.
+func OverridePayment(c *gin.Context) {
+	var req PaymentOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	paymentID := c.Param("id")
+	session := findPaymentSession(paymentID)
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "진행 중인 결제를 찾을 수 없습니다"})
+		return
+	}
+
+	// 결과를 받도록 먼저 구독한 뒤 처리를 전달
+	waiter := make(resultWaiter, 1)
+	session.subscribe(waiter)
+	defer session.unsubscribe(waiter)
+
+	override := paymentOverride{Status: req.Status, Reason: req.Reason, By: req.OverriddenBy}
+	if !overridePayment(session, override) {
+		c.JSON(http.StatusConflict, gin.H{"error": "이미 끝났거나 처리 중인 결제입니다"})
+		return
+	}
+
+	var result models.PaymentResponse
+	select {
+	case result = <-waiter:
+	case <-time.After(paymentOverrideWait):
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "처리 요청이 전달되었지만 결과를 아직 받지 못했습니다",
+			"session": session.Snapshot(),
+		})
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.Where("payment_id = ?", paymentID).First(&payment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("결제 기록 조회 실패: %v", err)})
+		return
+	}
+
+	// 처리 직전에 입금이 확인되어 세션이 먼저 끝난 경우
+	if payment.OverriddenAt == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "처리 전에 결제가 끝났습니다",
+			"payment": payment,
+			"result":  result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payment": payment,
+		"result":  result,
+	})
+}
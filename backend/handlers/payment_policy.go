@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"kiosk/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 입금 대기 정책 (조회 간격 곡선, 대기 시간, 카운트다운)
+var paymentPolicy *utils.PaymentPolicyStore
+
+// SetPaymentPolicy 결제 세션이 사용할 입금 대기 정책 설정 (결제 복구 전에 호출)
+func SetPaymentPolicy(store *utils.PaymentPolicyStore) {
+	paymentPolicy = store
+}
+
+// currentPaymentPolicy 새로 시작하는 결제에 적용할 정책
+func currentPaymentPolicy() utils.PaymentPolicy {
+	if paymentPolicy == nil {
+		return utils.DefaultPaymentPolicy(utils.DefaultDepositPollInterval)
+	}
+	return paymentPolicy.Get()
+}
+
+// GetPaymentPolicy 현재 입금 대기 정책 조회
+func GetPaymentPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, currentPaymentPolicy())
+}
+
+// UpdatePaymentPolicy 입금 대기 정책 변경 (조회 간격은 바로, 대기 시간과 카운트다운은 새로 시작하는 결제부터 적용)
+func UpdatePaymentPolicy(c *gin.Context) {
+	if paymentPolicy == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "입금 대기 정책이 초기화되지 않았습니다"})
+		return
+	}
+
+	var policy utils.PaymentPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := paymentPolicy.Update(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy = paymentPolicy.Get()
+	logMessage("[설정] 입금 대기 정책 변경 - 대기 시간: %v, 유예 시간: %v, 조회 구간: %d개",
+		time.Duration(policy.Timeout), time.Duration(policy.GracePeriod), len(policy.Schedule))
+	c.JSON(http.StatusOK, policy)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 결제 QR 코드 기본 크기 (PNG, 픽셀)
+const paymentQRSize = 300
+
+// GetPaymentQR 진행 중인 결제의 QR 코드와 딥링크를 반환합니다.
+// 금액은 서버가 결정한 입금 금액(부족 입금 후에는 남은 금액)이며, 입금 계좌는 결제가 배정된 계좌의 서버 설정(PAYEE_*)을 사용합니다.
+//
+//	format=json (기본값) 딥링크, 입금 안내, PNG data URL (송금 딥링크가 설정되었으면 그 QR 코드도 함께)
+//	format=png           PNG 이미지 (size로 크기 지정)
+//	format=svg           SVG 이미지
+//	link=toss (기본값)   QR 코드에 담을 딥링크 (transfer: 토스 외의 송금 앱용 딥링크, png/svg에만 적용)
+func GetPaymentQR(c *gin.Context) {
+	session := findPaymentSession(c.Param("id"))
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "진행 중인 결제를 찾을 수 없습니다"})
+		return
+	}
+
+	// 입금 계좌가 여러 개이면 결제가 배정된 계좌로 입금받음
+	payee := session.Payee
+	if payee == nil {
+		payeeInterface, _ := c.Get("payee")
+		payee, _ = payeeInterface.(*utils.PayeeConfig)
+	}
+	if payee == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "입금 계좌가 설정되지 않았습니다 (PAYEE_ACCOUNT_NO)"})
+		return
+	}
+	snapshot := session.Snapshot()
+	if snapshot.Result != nil || snapshot.Status != models.PaymentStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "이미 끝난 결제입니다"})
+		return
+	}
+
+	amount := snapshot.Amount - snapshot.Received
+	tossLink := payee.TossSendLink(amount)
+	transferLink := payee.TransferLink(amount)
+
+	// png/svg 이미지에 담을 딥링크
+	link := tossLink
+	switch c.DefaultQuery("link", "toss") {
+	case "toss":
+	case "transfer":
+		if transferLink == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "송금 딥링크가 설정되지 않았습니다 (PAYEE_BANK_CODE 또는 PAYEE_TRANSFER_LINK)"})
+			return
+		}
+		link = transferLink
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "link는 toss 또는 transfer여야 합니다"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "png":
+		size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(paymentQRSize)))
+		if err != nil || size < 64 || size > 1024 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size는 64~1024 사이여야 합니다"})
+			return
+		}
+		png, err := utils.QRCodePNG(link, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "image/png", png)
+
+	case "svg":
+		svg, err := utils.QRCodeSVG(link)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "image/svg+xml", []byte(svg))
+
+	case "json":
+		png, err := utils.QRCodePNG(tossLink, paymentQRSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response := gin.H{
+			"payment_id":    snapshot.PaymentID,
+			"order_id":      snapshot.OrderID,
+			"amount":        amount,
+			"order_amount":  snapshot.OrderAmount,
+			"account":       snapshot.Account,
+			"payee":         payee,
+			"toss_link":     tossLink,
+			"transfer_text": payee.TransferText(amount),
+			"qr_png":        "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		}
+		if transferLink != "" {
+			transferPNG, err := utils.QRCodePNG(transferLink, paymentQRSize)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			response["transfer_link"] = transferLink
+			response["transfer_qr_png"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(transferPNG)
+		}
+		c.JSON(http.StatusOK, response)
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format은 json, png, svg 중 하나여야 합니다"})
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createPaymentRecord 결제 시작 시 결제 기록을 생성합니다
+func createPaymentRecord(session *PaymentSession, depositBaseline int64) (*models.Payment, error) {
+	payment := &models.Payment{
+		PaymentID:       session.PaymentID,
+		OrderID:         session.OrderID,
+		ExpectedAmount:  session.Amount,
+		AmountOffset:    session.Amount - session.OrderAmount,
+		Provider:        session.Provider,
+		Account:         session.Account,
+		Method:          models.PaymentMethodTransfer,
+		DepositBaseline: depositBaseline,
+		Status:          models.PaymentStatusPending,
+		StartedAt:       session.StartedAt,
+		IdempotencyKey:  session.RequestID,
+	}
+	if err := database.DB.Create(payment).Error; err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// finishPaymentRecord 결제 종료 시 결과를 기록합니다
+func finishPaymentRecord(paymentID string, status string, actualChange int64, refundDue int64, attempts int, reason string) {
+	now := time.Now()
+	err := database.DB.Model(&models.Payment{}).
+		Where("payment_id = ?", paymentID).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"actual_change": actualChange,
+			"refund_due":    refundDue,
+			"attempts":      attempts,
+			"finished_at":   &now,
+			"cancel_reason": reason,
+		}).Error
+	if err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, Status: status},
+			"[중요] 결제 기록 저장 실패 - ID: %s, 상태: %s, 오류: %v", paymentID, status, err)
+	}
+}
+
+// GetPayments 결제 기록을 조회합니다 (기간/상태/주문 필터)
+func GetPayments(c *gin.Context) {
+	query := database.DB.Model(&models.Payment{})
+
+	// 기간 필터 (YYYY-MM-DD, 종료일 포함)
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, _, err := parseLocalDay(startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 시작일 형식. YYYY-MM-DD 형식을 사용하세요"})
+			return
+		}
+		query = query.Where("started_at >= ?", start)
+	}
+
+	if endDate := c.Query("end_date"); endDate != "" {
+		_, end, err := parseLocalDay(endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 종료일 형식. YYYY-MM-DD 형식을 사용하세요"})
+			return
+		}
+		query = query.Where("started_at < ?", end)
+	}
+
+	// 상태 필터
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// 결제 수단 필터
+	if method := c.Query("method"); method != "" {
+		query = query.Where("method = ?", method)
+	}
+
+	// 입금 계좌 필터
+	if account := c.Query("account"); account != "" {
+		query = query.Where("account = ?", account)
+	}
+
+	// 주문 필터
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	// 금액 범위 필터
+	if minAmount := c.Query("min_amount"); minAmount != "" {
+		if minVal, err := strconv.ParseInt(minAmount, 10, 64); err == nil {
+			query = query.Where("expected_amount >= ?", minVal)
+		}
+	}
+
+	if maxAmount := c.Query("max_amount"); maxAmount != "" {
+		if maxVal, err := strconv.ParseInt(maxAmount, 10, 64); err == nil {
+			query = query.Where("expected_amount <= ?", maxVal)
+		}
+	}
+
+	// 정렬 적용
+	sortBy := c.Query("sort_by")
+	order := c.Query("order")
+	allowedFields := map[string]bool{
+		"started_at":      true,
+		"finished_at":     true,
+		"expected_amount": true,
+	}
+	if !allowedFields[sortBy] {
+		sortBy = "started_at"
+	}
+	if order != "asc" {
+		order = "desc"
+	}
+	query = query.Order(fmt.Sprintf("%s %s", sortBy, order))
+
+	var payments []models.Payment
+	if err := query.Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start_date": c.Query("start_date"),
+		"end_date":   c.Query("end_date"),
+		"count":      len(payments),
+		"payments":   payments,
+	})
+}
+
+// GetPayment 결제 ID로 결제 기록을 조회합니다 (wait 매개변수가 있으면 진행 중인 세션의 롱폴링)
+func GetPayment(c *gin.Context) {
+	paymentID := c.Param("id")
+	if _, ok := c.GetQuery("wait"); ok {
+		// 웹소켓을 쓸 수 없는 클라이언트의 롱폴링
+		pollPayment(c, paymentID)
+		return
+	}
+
+	var payment models.Payment
+	if err := database.DB.Preload("Order.OrderItems.Menu").Where("payment_id = ?", paymentID).First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	c.JSON(http.StatusOK, payment)
+}
+
+// paymentResultFromRecord 이미 끝난 결제의 결과를 결제 기록으로부터 다시 만듭니다 (재연결한 클라이언트용)
+func paymentResultFromRecord(paymentID string) (models.PaymentResponse, error) {
+	var payment models.Payment
+	if err := database.DB.Where("payment_id = ?", paymentID).First(&payment).Error; err != nil {
+		return models.PaymentResponse{}, fmt.Errorf("결제를 찾을 수 없습니다: %s", paymentID)
+	}
+
+	details := map[string]interface{}{
+		"payment_id":      payment.PaymentID,
+		"order_id":        payment.OrderID,
+		"expected_amount": payment.ExpectedAmount,
+		"actual_change":   payment.ActualChange,
+		"refund_due":      payment.RefundDue,
+		"status":          payment.Status,
+	}
+	if payment.FinishedAt != nil {
+		details["finished_at"] = payment.FinishedAt.Format(time.RFC3339)
+		details["elapsed_time"] = payment.FinishedAt.Sub(payment.StartedAt).String()
+	}
+
+	switch payment.Status {
+	case models.PaymentStatusSucceeded:
+		response := models.PaymentResponse{Success: true, Message: "결제가 성공적으로 확인되었습니다", Details: details}
+		var order models.Order
+		if err := database.DB.First(&order, payment.OrderID).Error; err == nil && order.PaidAt == nil {
+			if remaining, err := orderRemaining(order); err == nil && remaining > 0 {
+				partialPaymentResponse(&response, remaining)
+			}
+		}
+		return response, nil
+	case models.PaymentStatusCancelled:
+		return models.PaymentResponse{Success: false, Message: "사용자 요청에 의해 결제가 취소되었습니다", Details: details}, nil
+	case models.PaymentStatusUnderpaid:
+		message := "입금액이 부족하여 결제가 완료되지 않았습니다"
+		if payment.CancelReason != "" {
+			message = payment.CancelReason
+		}
+		return models.PaymentResponse{Success: false, Message: message, Details: details}, nil
+	case models.PaymentStatusTimeout:
+		return models.PaymentResponse{Success: false, Message: "결제 확인 시간 초과", Details: details}, nil
+	case models.PaymentStatusReview:
+		return models.PaymentResponse{Success: false, Message: "직원 확인이 필요한 결제입니다", Details: details}, nil
+	case models.PaymentStatusFailed:
+		message := "결제에 실패했습니다"
+		if payment.CancelReason != "" {
+			message = payment.CancelReason
+		}
+		return models.PaymentResponse{Success: false, Message: message, Details: details}, nil
+	default:
+		// 진행 중인 세션 없이 대기 상태로 남은 기록 (서버 재시작 등)
+		return models.PaymentResponse{}, fmt.Errorf("진행 중인 결제 세션을 찾을 수 없습니다: %s", paymentID)
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"time"
+)
+
+// RecoverPayments 서버 재시작 전에 끝나지 않은 결제를 복구합니다.
+// 결제 시작 시 기록한 예수금(DepositBaseline)과 현재 예수금을 입금 계좌별로 비교하여
+// 이미 입금된 결제는 확인 처리하고, 입금되지 않은 결제는 남은 시간 동안 다시 기다리며,
+// 변동액을 설명할 수 없으면 직원 확인 대상으로 표시합니다.
+// 예수금 상태가 초기화된 뒤, 서버가 요청을 받기 전에 호출해야 합니다.
+func RecoverPayments(provider utils.PaymentProvider) error {
+	var pending []models.Payment
+	if err := database.DB.Where("status = ?", models.PaymentStatusPending).
+		Order("started_at asc, id asc").Find(&pending).Error; err != nil {
+		return fmt.Errorf("미완료 결제 조회 실패: %v", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	accounts := provider.Accounts()
+	logMessage("[복구] 미완료 결제 %d건 복구 시작 - 입금 계좌 %d개", len(pending), len(accounts))
+
+	// 입금 계좌별로 비교 (계좌 정보가 없는 이전 결제는 기본 계좌)
+	balances := make(map[string]int64, len(accounts))
+	for _, account := range accounts {
+		balances[account.ID] = account.Balance
+	}
+	primary := accounts[0].ID
+	byAccount := make(map[string][]models.Payment)
+	for _, payment := range pending {
+		// 다른 제공자로 시작된 결제는 예수금 기준이 달라 비교할 수 없음
+		if payment.Provider != provider.Name() {
+			flagPaymentForReview(payment, fmt.Sprintf("결제 제공자가 변경됨 (%s → %s)", payment.Provider, provider.Name()))
+			continue
+		}
+		account := payment.Account
+		if account == "" {
+			account = primary
+		}
+		if _, ok := balances[account]; !ok {
+			flagPaymentForReview(payment, fmt.Sprintf("입금 계좌가 설정에서 제거됨: %s", payment.Account))
+			continue
+		}
+		byAccount[account] = append(byAccount[account], payment)
+	}
+
+	for _, account := range accounts {
+		if candidates := byAccount[account.ID]; len(candidates) > 0 {
+			if err := recoverAccountPayments(provider, account.ID, account.ID == primary, account.Balance, candidates); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recoverAccountPayments 한 입금 계좌의 미완료 결제를 복구합니다 (candidates는 시작 순)
+func recoverAccountPayments(provider utils.PaymentProvider, account string, primary bool, currentDeposit int64, candidates []models.Payment) error {
+	logMessage("[복구] 입금 계좌 %s - 미완료 결제 %d건, 현재 예수금: %s원", account, len(candidates), utils.FormatNumber(currentDeposit))
+
+	// 가장 먼저 시작된 결제 이후의 예수금 변동 중 이미 성공 처리된 이체 결제로 설명되지 않는 금액
+	// (카운터 결제는 계좌와 무관하며, 결제 수단이 없는 기존 기록은 이체 결제)
+	earliest := candidates[0]
+	accounts := []string{account}
+	if primary {
+		accounts = append(accounts, "")
+	}
+	var settled int64
+	if err := database.DB.Model(&models.Payment{}).
+		Where("status = ? AND finished_at >= ? AND COALESCE(account, '') IN ? AND COALESCE(method, '') IN ?",
+			models.PaymentStatusSucceeded, earliest.StartedAt, accounts, []string{models.PaymentMethodTransfer, ""}).
+		Select("COALESCE(SUM(actual_change), 0)").Scan(&settled).Error; err != nil {
+		return fmt.Errorf("완료된 결제 합계 조회 실패: %v", err)
+	}
+	unexplained := currentDeposit - earliest.DepositBaseline - settled
+
+	// 실시간 매칭과 같은 규칙으로 변동액을 결제에 할당
+	matcher := utils.NewPaymentMatcher(0)
+	byID := make(map[string]models.Payment, len(candidates))
+	for _, payment := range candidates {
+		matcher.RegisterExact(payment.PaymentID, payment.ExpectedAmount)
+		byID[payment.PaymentID] = payment
+	}
+	matches, remainder := matcher.Match(unexplained)
+
+	for _, match := range matches {
+		payment := byID[match.PaymentID]
+		if !match.Complete() {
+			flagPaymentForReview(payment, fmt.Sprintf("재시작 중 부족 입금: %s원 중 %s원",
+				utils.FormatNumber(match.Expected), utils.FormatNumber(match.Received)))
+			continue
+		}
+		finishPaymentRecord(payment.PaymentID, models.PaymentStatusSucceeded, match.Received, match.Surplus(), payment.Attempts, "")
+		finishOrderPayment(payment.OrderID, payment.PaymentID, models.OrderStatusPaid)
+		recordPaymentRefund(payment.PaymentID, payment.OrderID, match.Surplus(), models.RefundSourceOverpaid, "초과 입금 (서버 재시작 중 확인)")
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventRecovered, PaymentID: payment.PaymentID, OrderID: payment.OrderID,
+			Account: account, Status: models.PaymentStatusSucceeded, Amount: match.Surplus(), Expected: match.Expected, Received: match.Received,
+			DepositBefore: depositValue(payment.DepositBaseline), DepositAfter: depositValue(currentDeposit)},
+			"[복구] 재시작 중 입금된 결제 확인 - ID: %s, 주문 ID: %d, 금액: %s원, 환불 필요: %s원",
+			payment.PaymentID, payment.OrderID, utils.FormatNumber(match.Received), utils.FormatNumber(match.Surplus()))
+	}
+
+	for _, p := range matcher.Pending() {
+		payment := byID[p.PaymentID]
+		if remainder != 0 {
+			flagPaymentForReview(payment, fmt.Sprintf("재시작 중 결제에 할당할 수 없는 예수금 변동: %s원", utils.FormatNumber(remainder)))
+			continue
+		}
+		resumePayment(provider, payment)
+	}
+	return nil
+}
+
+// resumePayment 입금되지 않은 결제를 남은 시간 동안 다시 기다리거나, 시간이 지났으면 만료 처리합니다
+func resumePayment(provider utils.PaymentProvider, payment models.Payment) {
+	policy := currentPaymentPolicy()
+	deadline := payment.StartedAt.Add(time.Duration(policy.Timeout + policy.GracePeriod))
+	if time.Now().After(deadline) {
+		finishPaymentRecord(payment.PaymentID, models.PaymentStatusTimeout, 0, 0, payment.Attempts, "결제 확인 시간 초과 (서버 재시작)")
+		finishOrderPayment(payment.OrderID, payment.PaymentID, models.OrderStatusExpired)
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventRecovered, PaymentID: payment.PaymentID, OrderID: payment.OrderID,
+			Account: payment.Account, Status: models.PaymentStatusTimeout, Expected: payment.ExpectedAmount, Attempt: payment.Attempts},
+			"[복구] 결제 시간 초과 처리 - ID: %s, 주문 ID: %d", payment.PaymentID, payment.OrderID)
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, payment.OrderID).Error; err != nil {
+		flagPaymentForReview(payment, "주문을 찾을 수 없음")
+		return
+	}
+	if order.Status != models.OrderStatusPendingPayment {
+		flagPaymentForReview(payment, fmt.Sprintf("주문이 결제 대기 상태가 아님: %s", order.Status))
+		return
+	}
+
+	session := &PaymentSession{
+		PaymentID:    payment.PaymentID,
+		OrderID:      payment.OrderID,
+		Amount:       payment.ExpectedAmount,
+		OrderAmount:  payment.ExpectedAmount - payment.AmountOffset,
+		Provider:     provider.Name(),
+		Account:      payment.Account,
+		StartedAt:    payment.StartedAt,
+		policy:       policy,
+		status:       models.PaymentStatusPending,
+		subscribers:  make(map[sessionSubscriber]bool),
+		cancelChan:   make(chan bool, 1),
+		overrideChan: make(chan paymentOverride, 1),
+		changed:      make(chan struct{}),
+	}
+
+	activePaymentsMutex.Lock()
+	activePayments[session.PaymentID] = session
+	activeOrderPayments[session.OrderID] = session.PaymentID
+	activePaymentsMutex.Unlock()
+
+	watch, err := provider.Resume(payment.PaymentID, payment.Account, payment.ExpectedAmount)
+	if err != nil {
+		releaseOrderPayment(session.OrderID, session.PaymentID)
+		flagPaymentForReview(payment, fmt.Sprintf("입금 대기 재개 실패: %v", err))
+		return
+	}
+	session.Account = watch.Account
+	session.Payee = watch.Payee
+
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventResumed, PaymentID: payment.PaymentID, OrderID: payment.OrderID,
+		Account: watch.Account, Expected: payment.ExpectedAmount, DepositBefore: depositValue(payment.DepositBaseline),
+		DepositAfter: depositValue(watch.Baseline)},
+		"[복구] 결제 확인 재개 - ID: %s, 주문 ID: %d, 금액: %s원, 남은 시간: %v",
+		payment.PaymentID, payment.OrderID, utils.FormatNumber(payment.ExpectedAmount), time.Until(deadline).Round(time.Second))
+	go runPaymentSession(session, provider, order, watch)
+}
+
+// flagPaymentForReview 자동으로 확인할 수 없는 결제를 직원 확인 대상으로 표시합니다 (주문은 결제 대기 상태로 유지)
+func flagPaymentForReview(payment models.Payment, reason string) {
+	err := database.DB.Model(&models.Payment{}).
+		Where("payment_id = ?", payment.PaymentID).
+		Updates(map[string]interface{}{
+			"status":        models.PaymentStatusReview,
+			"cancel_reason": reason,
+		}).Error
+	if err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: payment.PaymentID, OrderID: payment.OrderID},
+			"[중요] 결제 확인 필요 표시 실패 - ID: %s, 오류: %v", payment.PaymentID, err)
+		return
+	}
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventReview, Level: utils.PaymentLogWarn, PaymentID: payment.PaymentID,
+		OrderID: payment.OrderID, Account: payment.Account, Status: models.PaymentStatusReview, Expected: payment.ExpectedAmount},
+		"[중요] 직원 확인 필요 결제 - ID: %s, 주문 ID: %d, 금액: %s원, 사유: %s",
+		payment.PaymentID, payment.OrderID, utils.FormatNumber(payment.ExpectedAmount), reason)
+}
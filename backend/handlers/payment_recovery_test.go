@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+)
+
+func TestRecoverPaymentsIgnoresCounterPayments(t *testing.T) {
+	// 서버가 멈춘 동안 이체 결제 금액(3,000원)이 입금됨
+	provider := utils.NewSimulatorProvider(3000, 1)
+	if err := provider.Initialize(); err != nil {
+		t.Fatalf("예수금 상태 초기화 실패: %v", err)
+	}
+
+	order := createPendingOrder(t, 3000)
+	startedAt := time.Now().Add(-10 * time.Second)
+	pending := models.Payment{
+		PaymentID:      "recover-transfer",
+		OrderID:        order.ID,
+		ExpectedAmount: 3000,
+		Provider:       utils.ProviderSimulator,
+		Account:        "sim-1",
+		Method:         models.PaymentMethodTransfer,
+		Status:         models.PaymentStatusPending,
+		StartedAt:      startedAt,
+	}
+	if err := database.DB.Create(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 같은 시간에 카운터에서 받은 현금 결제 - 계좌 예수금과 무관
+	cashOrder := createPendingOrder(t, 2000)
+	finishedAt := startedAt.Add(5 * time.Second)
+	cash := models.Payment{
+		PaymentID:      "recover-cash",
+		OrderID:        cashOrder.ID,
+		ExpectedAmount: 2000,
+		Provider:       models.PaymentMethodCash,
+		Method:         models.PaymentMethodCash,
+		ActualChange:   2000,
+		Status:         models.PaymentStatusSucceeded,
+		StartedAt:      finishedAt,
+		FinishedAt:     &finishedAt,
+	}
+	if err := database.DB.Create(&cash).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecoverPayments(provider); err != nil {
+		t.Fatalf("결제 복구 실패: %v", err)
+	}
+
+	var recovered models.Payment
+	database.DB.Where("payment_id = ?", pending.PaymentID).First(&recovered)
+	if recovered.Status != models.PaymentStatusSucceeded || recovered.ActualChange != 3000 {
+		t.Fatalf("복구된 결제 = %s (입금액 %d, 사유: %s), want succeeded (3000)",
+			recovered.Status, recovered.ActualChange, recovered.CancelReason)
+	}
+	var saved models.Order
+	database.DB.First(&saved, order.ID)
+	if saved.Status != models.OrderStatusPaid {
+		t.Fatalf("주문 상태 = %s, want paid", saved.Status)
+	}
+}
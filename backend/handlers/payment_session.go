@@ -0,0 +1,789 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	// 진행 중인 결제 세션 관리 (웹소켓 연결과 독립적으로 유지됨)
+	activePayments = make(map[string]*PaymentSession)
+	// 주문별 진행 중인 결제 ID (한 주문에 동시에 두 결제가 진행되지 않도록)
+	activeOrderPayments = make(map[uint]string)
+	activePaymentsMutex sync.Mutex
+)
+
+// sessionSubscriber 결제 세션의 메시지를 받는 대상 (웹소켓 연결 등)
+type sessionSubscriber interface {
+	send(msgType string, payload interface{}) error
+}
+
+// PaymentSession 진행 중인 결제 세션
+// 결제를 시작한 웹소켓 연결이 끊어져도 세션은 계속 입금을 기다리며,
+// 다시 연결한 클라이언트는 subscribe 메시지로 상태와 최종 결과를 받을 수 있습니다.
+type PaymentSession struct {
+	PaymentID   string
+	OrderID     uint
+	Amount      int64 // 고객이 입금해야 할 금액 (오프셋 포함)
+	OrderAmount int64 // 주문 총액
+	Provider    string
+	Account     string             // 입금받을 계좌 ID
+	Payee       *utils.PayeeConfig // 입금받을 계좌의 QR 코드용 정보 (nil이면 기본 입금 계좌)
+	StartedAt   time.Time
+	RequestID   string              // 결제 시작 요청 키 (재전송된 요청 확인용)
+	policy      utils.PaymentPolicy // 결제 시작 시점의 입금 대기 정책 (정책이 바뀌어도 진행 중인 결제는 그대로)
+
+	mu           sync.Mutex
+	status       string
+	received     int64 // 지금까지 이 결제에 할당된 입금액 (부족 입금 시 남은 금액 계산용)
+	lastStatus   *PaymentStatus
+	result       *models.PaymentResponse
+	subscribers  map[sessionSubscriber]bool
+	cancelChan   chan bool
+	overrideChan chan paymentOverride // 직원의 강제 성공/실패 처리
+
+	version uint64         // 메시지를 보낼 때마다 증가 (HTTP 롱폴링 기준)
+	events  []SessionEvent // 최근 메시지 (HTTP 롱폴링 클라이언트용)
+	changed chan struct{}  // 다음 메시지를 보낼 때 닫힘
+}
+
+// sessionEventHistory HTTP 롱폴링을 위해 세션마다 보관하는 최근 메시지 수
+const sessionEventHistory = 32
+
+// SessionEvent 결제 세션이 보낸 메시지 (웹소켓 메시지와 같은 type/payload)
+type SessionEvent struct {
+	Version uint64      `json:"version"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+// PaymentSessionSnapshot 결제 세션의 현재 상태
+type PaymentSessionSnapshot struct {
+	PaymentID   string                  `json:"payment_id"`
+	OrderID     uint                    `json:"order_id"`
+	Amount      int64                   `json:"amount"`
+	OrderAmount int64                   `json:"order_amount"`
+	Received    int64                   `json:"received"` // 지금까지 확인된 입금액 (부족 입금 시)
+	Provider    string                  `json:"provider"`
+	Account     string                  `json:"account,omitempty"`
+	StartedAt   time.Time               `json:"started_at"`
+	Status      string                  `json:"status"`
+	Attempt     int                     `json:"attempt"`
+	MaxAttempts int                     `json:"max_attempts"`
+	Subscribers int                     `json:"subscribers"`
+	Version     uint64                  `json:"version"`
+	Result      *models.PaymentResponse `json:"result,omitempty"`
+}
+
+// snapshotLocked 세션 상태 스냅샷 (s.mu 잠금 상태에서 호출)
+func (s *PaymentSession) snapshotLocked() PaymentSessionSnapshot {
+	snapshot := PaymentSessionSnapshot{
+		PaymentID:   s.PaymentID,
+		OrderID:     s.OrderID,
+		Amount:      s.Amount,
+		OrderAmount: s.OrderAmount,
+		Provider:    s.Provider,
+		Account:     s.Account,
+		StartedAt:   s.StartedAt,
+		Status:      s.status,
+		Received:    s.received,
+		Subscribers: len(s.subscribers),
+		Version:     s.version,
+		Result:      s.result,
+	}
+	if s.lastStatus != nil {
+		snapshot.Attempt = s.lastStatus.Attempt
+		snapshot.MaxAttempts = s.lastStatus.MaxAttempts
+	}
+	return snapshot
+}
+
+// Snapshot 세션 상태 스냅샷
+func (s *PaymentSession) Snapshot() PaymentSessionSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// subscribe 구독자를 등록하고 현재 상태를 반환합니다. 이미 끝난 세션이면 결과만 반환하고 등록하지 않습니다.
+func (s *PaymentSession) subscribe(sub sessionSubscriber) PaymentSessionSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.result == nil {
+		s.subscribers[sub] = true
+	}
+	return s.snapshotLocked()
+}
+
+// unsubscribe 구독 해제 (세션은 계속 진행됨)
+func (s *PaymentSession) unsubscribe(sub sessionSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// publish 모든 구독자에게 메시지 전송. 전송에 실패한 구독자는 제거됩니다.
+func (s *PaymentSession) publish(msgType string, payload interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status, ok := payload.(PaymentStatus); ok {
+		s.lastStatus = &status
+	}
+
+	// HTTP 롱폴링 클라이언트를 위해 보관하고 대기 중인 요청을 깨움
+	s.version++
+	s.events = append(s.events, SessionEvent{Version: s.version, Type: msgType, Payload: payload})
+	if len(s.events) > sessionEventHistory {
+		s.events = s.events[len(s.events)-sessionEventHistory:]
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	for sub := range s.subscribers {
+		if err := sub.send(msgType, payload); err != nil {
+			log.Printf("결제 세션 구독자 제거 - ID: %s, 오류: %v", s.PaymentID, err)
+			delete(s.subscribers, sub)
+		}
+	}
+}
+
+// finish 최종 결과를 저장하고 구독자에게 전송합니다
+func (s *PaymentSession) finish(status string, result models.PaymentResponse) {
+	s.mu.Lock()
+	s.status = status
+	s.result = &result
+	s.mu.Unlock()
+
+	s.publish(MsgTypePaymentResult, result)
+
+	s.mu.Lock()
+	s.subscribers = make(map[sessionSubscriber]bool)
+	s.mu.Unlock()
+}
+
+// waitForChange since 이후의 메시지가 있거나 결제가 끝날 때까지 최대 timeout 동안 기다린 뒤
+// 현재 상태와 since 이후의 메시지를 반환합니다 (HTTP 롱폴링)
+func (s *PaymentSession) waitForChange(ctx context.Context, since uint64, timeout time.Duration) (PaymentSessionSnapshot, []SessionEvent) {
+	s.mu.Lock()
+	if s.version <= since && s.result == nil && timeout > 0 {
+		changed := s.changed
+		s.mu.Unlock()
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	events := []SessionEvent{}
+	for _, event := range s.events {
+		if event.Version > since {
+			events = append(events, event)
+		}
+	}
+	return s.snapshotLocked(), events
+}
+
+// findPaymentSession 진행 중인 결제 세션 조회
+func findPaymentSession(paymentID string) *PaymentSession {
+	activePaymentsMutex.Lock()
+	defer activePaymentsMutex.Unlock()
+	return activePayments[paymentID]
+}
+
+// startPaymentSession 주문의 결제 세션을 시작합니다.
+// req.Amount는 이번 결제로 받을 금액입니다 (0이면 남은 금액 전체, 분할 결제 시 일부).
+// req.RequestID로 이미 시작된 결제가 있으면 새 세션을 만들지 않고 *PaymentReplayError를 반환합니다.
+// sub가 있으면 세션을 구독하고 payment_initiated 메시지를 받습니다.
+func startPaymentSession(provider utils.PaymentProvider, req models.PaymentRequest, sub sessionSubscriber) (*PaymentSession, error) {
+	// 결제 ID 생성
+	paymentID := uuid.New().String()
+
+	session := &PaymentSession{
+		PaymentID:    paymentID,
+		OrderID:      req.OrderID,
+		Provider:     provider.Name(),
+		StartedAt:    time.Now(),
+		RequestID:    req.RequestID,
+		policy:       currentPaymentPolicy(),
+		status:       models.PaymentStatusPending,
+		subscribers:  make(map[sessionSubscriber]bool),
+		cancelChan:   make(chan bool, 1),
+		overrideChan: make(chan paymentOverride, 1),
+		changed:      make(chan struct{}),
+	}
+
+	// 주문 확인 및 결제 대기 상태로 전환 (결제 금액은 서버의 주문 총액과 이미 결제된 금액으로 결정)
+	order, leg, err := beginOrderPayment(req.OrderID, req.Amount, session)
+	if err != nil {
+		return nil, err
+	}
+
+	// 입금 대기 등록 - 동시 결제와 구분되도록 오프셋이 더해진 금액을 받음
+	watch, err := provider.Start(paymentID, leg)
+	if err != nil {
+		releaseOrderPayment(order.ID, paymentID)
+		return nil, err
+	}
+	session.Amount = watch.Amount
+	session.OrderAmount = leg
+	session.Account = watch.Account
+	session.Payee = watch.Payee
+
+	// 결제 기록 생성 - 기록이 없으면 재시작 후 복구와 재전송된 요청 확인을 할 수 없으므로 결제를 시작하지 않음
+	if _, err := createPaymentRecord(session, watch.Baseline); err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, OrderID: req.OrderID},
+			"[중요] 결제 기록 생성 실패 - ID: %s, 오류: %v", paymentID, err)
+		provider.Cancel(paymentID)
+		releaseOrderPayment(order.ID, paymentID)
+		return nil, fmt.Errorf("결제 기록을 생성하지 못했습니다: %v", err)
+	}
+
+	if sub != nil {
+		session.subscribe(sub)
+		// 결제 ID를 클라이언트에 알림 (QR/딥링크는 amount로 생성해야 함)
+		sub.send(MsgTypePaymentInitiated, session.initiatedPayload())
+	}
+
+	// 비동기로 결제 처리 시작
+	go runPaymentSession(session, provider, order, watch)
+	return session, nil
+}
+
+// initiatedPayload payment_initiated 메시지 내용
+func (s *PaymentSession) initiatedPayload() gin.H {
+	return gin.H{
+		"payment_id":    s.PaymentID,
+		"order_id":      s.OrderID,
+		"amount":        s.Amount,
+		"order_amount":  s.OrderAmount,
+		"amount_offset": s.Amount - s.OrderAmount,
+		"qr_url":        fmt.Sprintf("/api/payments/%s/qr", s.PaymentID),
+		"timestamp":     s.StartedAt.Format(time.RFC3339),
+	}
+}
+
+// claimOrderPayment 결제 세션 없이 직원이 주문의 결제를 처리하는 동안 다른 결제가 시작되지 않도록 주문을 잡아둡니다.
+// 결제 대기, 결제 오류, 시간 초과 상태의 주문만 가능하며, 처리가 끝나면 releaseOrderPayment로 해제해야 합니다.
+func claimOrderPayment(orderID uint, paymentID string) (models.Order, error) {
+	activePaymentsMutex.Lock()
+	defer activePaymentsMutex.Unlock()
+
+	if existing, ok := activeOrderPayments[orderID]; ok {
+		return models.Order{}, fmt.Errorf("이미 결제가 진행 중인 주문입니다 (결제 ID: %s)", existing)
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, orderID).Error; err != nil {
+		return order, fmt.Errorf("주문을 찾을 수 없습니다: %d", orderID)
+	}
+	if !models.CanTransitionOrder(order.Status, models.OrderStatusPaid) {
+		return order, fmt.Errorf("결제할 수 없는 주문 상태입니다: %s", order.Status)
+	}
+
+	activeOrderPayments[orderID] = paymentID
+	return order, nil
+}
+
+// beginOrderPayment 주문의 결제를 시작할 수 있는지 확인하고 진행 중인 결제로 등록합니다.
+// 결제 오류나 시간 초과로 끝난 주문은 다시 결제 대기 상태로 돌립니다.
+// 이번 결제로 받을 금액(amount가 0이면 남은 금액 전체)을 함께 반환합니다.
+func beginOrderPayment(orderID uint, amount int64, session *PaymentSession) (models.Order, int64, error) {
+	activePaymentsMutex.Lock()
+	defer activePaymentsMutex.Unlock()
+
+	// 재전송된 요청이면 처음 시작된 결제를 알려줌
+	if session.RequestID != "" {
+		if err := findIdempotentPaymentLocked(session.RequestID, orderID); err != nil {
+			return models.Order{}, 0, err
+		}
+	}
+
+	if existing, ok := activeOrderPayments[orderID]; ok {
+		return models.Order{}, 0, fmt.Errorf("이미 결제가 진행 중인 주문입니다 (결제 ID: %s)", existing)
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, orderID).Error; err != nil {
+		return order, 0, fmt.Errorf("주문을 찾을 수 없습니다: %d", orderID)
+	}
+
+	switch order.Status {
+	case models.OrderStatusPendingPayment:
+		// 그대로 진행
+	case models.OrderStatusPaymentFailed, models.OrderStatusExpired:
+		// 재시도
+		var err error
+		if order, err = transitionOrderStatus(orderID, models.OrderStatusPendingPayment); err != nil {
+			return order, 0, fmt.Errorf("주문 상태 변경 실패: %v", err)
+		}
+	default:
+		return order, 0, fmt.Errorf("결제할 수 없는 주문 상태입니다: %s", order.Status)
+	}
+
+	if order.TotalPrice <= 0 {
+		return order, 0, fmt.Errorf("결제 금액이 올바르지 않습니다: %d", order.TotalPrice)
+	}
+	leg, err := legAmountFor(order, amount)
+	if err != nil {
+		return order, 0, err
+	}
+
+	activePayments[session.PaymentID] = session
+	activeOrderPayments[orderID] = session.PaymentID
+	return order, leg, nil
+}
+
+// releaseOrderPayment 진행 중인 결제 목록에서 제거합니다
+func releaseOrderPayment(orderID uint, paymentID string) {
+	activePaymentsMutex.Lock()
+	defer activePaymentsMutex.Unlock()
+	delete(activePayments, paymentID)
+	if activeOrderPayments[orderID] == paymentID {
+		delete(activeOrderPayments, orderID)
+	}
+}
+
+// finishOrderPayment 결제 결과에 따라 주문 상태를 전환하고 주문의 남은 금액을 반환합니다.
+// 성공한 결제가 주문 금액의 일부(분할 결제)이면 주문은 결제 대기 상태로 남고,
+// 이미 일부 결제된 주문은 이번 결제가 실패해도 나머지를 받을 수 있도록 결제 대기 상태로 둡니다.
+func finishOrderPayment(orderID uint, paymentID string, status string) int64 {
+	var remaining int64
+	var err error
+	if status == models.OrderStatusPaid {
+		var payment models.Payment
+		if err = database.DB.Where("payment_id = ?", paymentID).First(&payment).Error; err == nil {
+			_, remaining, err = settleOrderLeg(orderID, payment)
+		}
+	} else {
+		var paid int64
+		if paid, _, err = orderPaidLegs(orderID, paymentID); err == nil && paid > 0 {
+			status = models.OrderStatusPendingPayment
+			var order models.Order
+			if err = database.DB.First(&order, orderID).Error; err == nil {
+				remaining = int64(order.TotalPrice) - paid
+				if order.Status != status {
+					_, err = transitionOrderStatus(orderID, status)
+				}
+			}
+		} else if err == nil {
+			_, err = transitionOrderStatus(orderID, status)
+		}
+	}
+	if err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, OrderID: orderID, Status: status},
+			"[중요] 주문 상태 전환 실패 - 주문 ID: %d, 결제 ID: %s, 상태: %s, 오류: %v", orderID, paymentID, status, err)
+	}
+	return remaining
+}
+
+// 결제 취소 함수
+func cancelPayment(paymentID string) bool {
+	session := findPaymentSession(paymentID)
+	if session == nil {
+		return false // 결제 ID가 없음
+	}
+
+	session.mu.Lock()
+	finished := session.result != nil
+	session.mu.Unlock()
+	if finished {
+		return false // 이미 완료됨
+	}
+
+	// 취소 신호 전송
+	select {
+	case session.cancelChan <- true:
+		// 신호가 성공적으로 전송됨
+	default:
+		// 이미 취소 신호가 전송된 상태
+	}
+	return true
+}
+
+// runPaymentSession 입금 확인을 기다리고 결과를 구독자에게 전송합니다
+func runPaymentSession(session *PaymentSession, provider utils.PaymentProvider,
+	order models.Order, watch *utils.PaymentWatch) {
+	paymentID := session.PaymentID
+	amount := session.Amount
+
+	// 결제 결과에 따른 주문 상태 (취소/시간 초과로 끝나지 않으면 결제 오류로 처리)
+	orderStatus := models.OrderStatusPaymentFailed
+
+	// 결제 기록에 남길 결과
+	paymentStatus := models.PaymentStatusFailed
+	failureReason := ""
+	attempts := 0
+	var actualChange int64
+	var refundDue int64 // 고객에게 돌려줘야 할 금액 (초과 입금액, 부족 입금 후 미완료 시 입금액)
+	var response models.PaymentResponse
+
+	// applyLateMatch 대기 종료 후 확인 채널에 남아 있던 입금 반영
+	applyLateMatch := func(match utils.PaymentMatch) {
+		session.mu.Lock()
+		session.received = match.Received
+		session.mu.Unlock()
+
+		switch {
+		case paymentStatus == models.PaymentStatusSucceeded:
+			// 직원 확인으로 이미 완료됨 - 실제 입금액으로 초과분만 반영
+			if match.Received > actualChange {
+				actualChange = match.Received
+			}
+			refundDue = match.Surplus()
+		case match.Complete() && orderStatus == models.OrderStatusExpired:
+			// 시간 초과와 같은 시점에 입금이 완료됨 - 늦은 결제 성공으로 처리
+			actualChange = match.Received
+			refundDue = match.Surplus()
+			orderStatus = models.OrderStatusPaid
+			paymentStatus = models.PaymentStatusSucceeded
+			failureReason = ""
+			response = models.PaymentResponse{
+				Success: true,
+				Message: "결제가 성공적으로 확인되었습니다",
+				Details: map[string]interface{}{
+					"payment_id":      paymentID,
+					"order_id":        order.ID,
+					"expected_amount": amount,
+					"verified_at":     time.Now().Format(time.RFC3339),
+					"elapsed_time":    time.Since(session.StartedAt).String(),
+				},
+			}
+		default:
+			// 취소/실패 처리된 결제에 입금됨 - 입금액 전체가 환불 대상
+			actualChange = match.Received
+			refundDue = actualChange
+			if !match.Complete() {
+				paymentStatus = models.PaymentStatusUnderpaid
+			}
+			failureReason = fmt.Sprintf("결제 종료 시점에 입금 확인 (환불 필요: %s원)", utils.FormatNumber(refundDue))
+			response.Message = "결제가 완료되지 않았습니다. 입금하신 금액은 환불해 드립니다"
+		}
+		if response.Details != nil {
+			response.Details["actual_change"] = actualChange
+			response.Details["refund_due"] = refundDue
+		}
+
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventDepositMatched, Level: utils.PaymentLogWarn, PaymentID: paymentID,
+			OrderID: order.ID, Account: watch.Account, Status: paymentStatus, Amount: match.Amount, Expected: match.Expected, Received: match.Received},
+			"[중요] 결제 대기 종료 시점에 확인된 입금 - ID: %s, 입금액: %s원, 요청 금액: %s원, 처리: %s",
+			paymentID, utils.FormatNumber(match.Received), utils.FormatNumber(amount), paymentStatus)
+	}
+
+	// 함수 종료시 결과 저장 후 구독자에게 전송하고 결제 작업 정리
+	defer func() {
+		// 입금 대기를 먼저 해제한 뒤 그 전에 할당되어 채널에 남은 입금을 반영
+		// (시간 초과, 취소, 직원 처리와 같은 시점에 확인된 입금이 사라지지 않도록)
+		provider.Cancel(paymentID)
+		for drained := false; !drained; {
+			select {
+			case match := <-watch.Confirmed:
+				applyLateMatch(match)
+			default:
+				drained = true
+			}
+		}
+
+		level := utils.PaymentLogInfo
+		if paymentStatus != models.PaymentStatusSucceeded && paymentStatus != models.PaymentStatusCancelled || refundDue > 0 {
+			level = utils.PaymentLogWarn
+		}
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventFinished, Level: level, PaymentID: paymentID, OrderID: order.ID,
+			Account: watch.Account, Status: paymentStatus, Amount: refundDue, Expected: amount, Received: actualChange,
+			DepositBefore: depositValue(watch.Baseline), DepositAfter: depositValue(provider.Poll(paymentID).Balance), Attempt: attempts},
+			"결제 종료 - ID: %s, 상태: %s, 입금액: %s원, 환불 필요: %s원", paymentID, paymentStatus,
+			utils.FormatNumber(actualChange), utils.FormatNumber(refundDue))
+
+		finishPaymentRecord(paymentID, paymentStatus, actualChange, refundDue, attempts, failureReason)
+		if remaining := finishOrderPayment(order.ID, paymentID, orderStatus); remaining > 0 && paymentStatus == models.PaymentStatusSucceeded {
+			// 분할 결제 - 이번 결제는 성공했지만 주문 금액이 남아 있음
+			partialPaymentResponse(&response, remaining)
+		}
+		if paymentStatus != models.PaymentStatusSucceeded {
+			// 결제가 완료되지 않았는데 입금된 금액 (부족 입금, 종료 시점에 확인된 입금)
+			recordPaymentRefund(paymentID, order.ID, refundDue, models.RefundSourceUnderpaid, failureReason)
+		} else {
+			recordPaymentRefund(paymentID, order.ID, refundDue, models.RefundSourceOverpaid, "초과 입금")
+		}
+
+		session.finish(paymentStatus, response)
+		releaseOrderPayment(order.ID, paymentID)
+	}()
+
+	// 초기 예수금 로깅 (입금 대기 등록 시점의 예수금)
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventStarted, PaymentID: paymentID, OrderID: order.ID, Account: watch.Account,
+		Expected: amount, DepositBefore: depositValue(watch.Baseline)},
+		"결제 요청 시작 - ID: %s, 주문 ID: %d, 요청 금액: %s원, 초기 예수금: %s원, 제공자: %s, 계좌: %s",
+		paymentID, order.ID, utils.FormatNumber(amount), utils.FormatNumber(watch.Baseline), provider.Name(), watch.Account)
+
+	// 입금 대기 정책 (대기 시간, 유예 시간, 카운트다운 단위)
+	policy := session.policy
+	step := time.Duration(policy.CountdownStep)
+	success := false
+
+	// 결제 처리 시작 시간 (재시작 후 재개된 세션은 이미 지난 시간만큼 남은 시간이 줄어듦)
+	startTime := session.StartedAt
+	// 고객에게 보여주는 시간 초과 시각 (부족 입금, 은행 조회 장애 시 늘어남) - 이후 유예 시간 동안 늦은 입금을 더 기다림
+	deadline := startTime.Add(time.Duration(policy.Timeout))
+
+	// 상태 전송 주기 (입금 확인은 결제 제공자가 정책의 조회 간격 곡선에 따라 담당)
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+
+	// 은행 조회 장애로 대기 시간을 멈춘 시간
+	var paused time.Duration
+
+waitLoop:
+	for {
+		attempt := policy.Steps(time.Since(startTime) - paused)
+		attempts = attempt
+
+		select {
+		case <-session.cancelChan:
+			// 취소 요청 수신
+			logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventCancelRequested, PaymentID: paymentID, OrderID: order.ID,
+				Expected: amount, Received: actualChange, Attempt: attempt},
+				"결제 취소 요청 수신 - ID: %s, 시도 #%d에서 중단됨", paymentID, attempt)
+
+			// 결제 취소 결과 전송
+			orderStatus = models.OrderStatusCancelled
+			paymentStatus = models.PaymentStatusCancelled
+			failureReason = "사용자 요청에 의한 취소"
+			if actualChange > 0 {
+				// 부족 입금 상태에서 취소 - 입금된 금액은 환불 대상
+				paymentStatus = models.PaymentStatusUnderpaid
+				refundDue = actualChange
+				failureReason = fmt.Sprintf("부족 입금 후 사용자 취소 (환불 필요: %s원)", utils.FormatNumber(refundDue))
+				logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventCancelRequested, Level: utils.PaymentLogWarn, PaymentID: paymentID,
+					OrderID: order.ID, Amount: refundDue, Expected: amount, Received: actualChange, Attempt: attempt},
+					"[중요] 부족 입금 결제 취소 - ID: %s, 입금액: %s원, 요청 금액: %s원",
+					paymentID, utils.FormatNumber(actualChange), utils.FormatNumber(amount))
+			}
+			response = models.PaymentResponse{
+				Success: false,
+				Message: "사용자 요청에 의해 결제가 취소되었습니다",
+				Details: map[string]interface{}{
+					"payment_id":      paymentID,
+					"order_id":        order.ID,
+					"expected_amount": amount,
+					"actual_change":   actualChange,
+					"refund_due":      refundDue,
+					"cancelled_at":    time.Now().Format(time.RFC3339),
+					"elapsed_time":    time.Since(startTime).String(),
+					"attempt":         attempt,
+				},
+			}
+			return
+
+		case override := <-session.overrideChan:
+			// 직원이 결제 결과를 직접 결정함 (입금 확인 누락 등)
+			recordPaymentOverride(paymentID, override)
+			logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventOverride, Level: utils.PaymentLogWarn, PaymentID: paymentID,
+				OrderID: order.ID, Account: watch.Account, Status: override.Status, Expected: amount, Received: actualChange, Attempt: attempt},
+				"[직원 처리] 결제 강제 %s - ID: %s, 주문 ID: %d, 입금 확인액: %s원, 처리: %s, 사유: %s",
+				override.Status, paymentID, order.ID, utils.FormatNumber(actualChange), override.By, override.Reason)
+
+			details := map[string]interface{}{
+				"payment_id":      paymentID,
+				"order_id":        order.ID,
+				"expected_amount": amount,
+				"actual_change":   actualChange,
+				"overridden":      true,
+				"override_reason": override.Reason,
+				"elapsed_time":    time.Since(startTime).String(),
+				"attempt":         attempt,
+			}
+			if override.Status == models.PaymentStatusSucceeded {
+				// 고객이 요청 금액을 입금한 것으로 확인됨 - 늦게 관측된 입금은 할당되지 않은 변동으로 남음
+				actualChange = amount
+				orderStatus = models.OrderStatusPaid
+				paymentStatus = models.PaymentStatusSucceeded
+				failureReason = ""
+				details["actual_change"] = actualChange
+				details["verified_at"] = time.Now().Format(time.RFC3339)
+				response = models.PaymentResponse{Success: true, Message: "직원 확인으로 결제가 완료되었습니다", Details: details}
+				return
+			}
+
+			orderStatus = models.OrderStatusPaymentFailed
+			paymentStatus = models.PaymentStatusFailed
+			failureReason = fmt.Sprintf("직원 처리: %s", override.Reason)
+			if actualChange > 0 {
+				// 부족 입금 상태에서 실패 처리 - 입금된 금액은 환불 대상
+				paymentStatus = models.PaymentStatusUnderpaid
+				refundDue = actualChange
+				failureReason = fmt.Sprintf("부족 입금 후 직원 처리: %s (환불 필요: %s원)", override.Reason, utils.FormatNumber(refundDue))
+			}
+			details["refund_due"] = refundDue
+			response = models.PaymentResponse{Success: false, Message: "결제가 확인되지 않았습니다. 직원에게 문의해 주세요", Details: details}
+			return
+
+		case match := <-watch.Confirmed:
+			// 제공자가 이 결제에 입금액을 할당함
+			actualChange = match.Received
+			session.mu.Lock()
+			session.received = match.Received
+			session.mu.Unlock()
+			matched := utils.PaymentLogEvent{Type: PaymentEventDepositMatched, PaymentID: paymentID, OrderID: order.ID, Account: watch.Account,
+				Amount: match.Amount, Expected: match.Expected, Received: match.Received,
+				DepositAfter: depositValue(provider.Poll(paymentID).Balance), Attempt: attempt}
+
+			if !match.Complete() {
+				// 부족 입금 - 나머지 금액의 추가 입금을 기다림
+				remaining := match.Expected - match.Received
+				if topUp := time.Now().Add(time.Duration(policy.TopUpWait)); deadline.Before(topUp) {
+					deadline = topUp
+				}
+				maxAttempts := policy.Steps(deadline.Sub(startTime) - paused)
+				matched.Level = utils.PaymentLogWarn
+				logPaymentEvent(matched, "[주의] 부족 입금 - ID: %s, 입금액: %s원, 요청 금액: %s원, 추가 입금 필요: %s원",
+					paymentID, utils.FormatNumber(match.Received), utils.FormatNumber(amount), utils.FormatNumber(remaining))
+				session.publish(MsgTypePaymentUnderpaid, gin.H{
+					"payment_id":   paymentID,
+					"order_id":     order.ID,
+					"received":     match.Received,
+					"expected":     match.Expected,
+					"remaining":    remaining,
+					"max_attempts": maxAttempts,
+				})
+				continue
+			}
+
+			success = true
+			if surplus := match.Surplus(); surplus > 0 {
+				// 초과 입금 - 결제는 완료하고 초과분은 환불 대상으로 기록
+				refundDue = surplus
+				matched.Level = utils.PaymentLogWarn
+				logPaymentEvent(matched, "[주의] 초과 입금 - ID: %s, 입금액: %s원, 요청 금액: %s원, 환불 필요: %s원",
+					paymentID, utils.FormatNumber(match.Received), utils.FormatNumber(amount), utils.FormatNumber(surplus))
+				session.publish(MsgTypePaymentOverpaid, gin.H{
+					"payment_id": paymentID,
+					"order_id":   order.ID,
+					"received":   match.Received,
+					"expected":   match.Expected,
+					"surplus":    surplus,
+				})
+			} else {
+				logPaymentEvent(matched, "결제 성공 - ID: %s, 요청 금액: %s원, 실제 변동액: %s원, 소요 시간: %v",
+					paymentID, utils.FormatNumber(amount), utils.FormatNumber(actualChange), time.Since(startTime))
+			}
+			break waitLoop
+
+		case <-ticker.C:
+			check := provider.Poll(paymentID)
+			now := time.Now()
+
+			// 은행 조회가 원활하지 않으면 입금을 확인할 수 없으므로 대기 시간을 멈춤
+			degraded := check.Degraded() && paused < time.Duration(policy.MaxOutagePause) && now.Before(deadline)
+			if degraded {
+				paused += step
+				deadline = deadline.Add(step)
+			}
+
+			// 유예 시간까지 입금이 확인되지 않으면 시간 초과
+			if now.After(deadline.Add(time.Duration(policy.GracePeriod))) {
+				break waitLoop
+			}
+			grace := now.After(deadline)
+
+			// 상태 업데이트 전송
+			maxAttempts := policy.Steps(deadline.Sub(startTime) - paused)
+			status := PaymentStatus{
+				PaymentID:        paymentID,
+				Attempt:          policy.Steps(now.Sub(startTime) - paused),
+				MaxAttempts:      maxAttempts,
+				RemainingSeconds: int(deadline.Sub(now).Round(time.Second) / time.Second),
+				ActualChange:     actualChange,
+				Degraded:         degraded,
+				Grace:            grace,
+			}
+			if status.Attempt > maxAttempts {
+				status.Attempt = maxAttempts
+			}
+			if grace {
+				status.RemainingSeconds = 0
+				status.Notice = "입금 확인을 마무리하고 있습니다. 잠시만 기다려 주세요"
+			} else if degraded {
+				status.Notice = "은행 응답이 지연되고 있습니다. 입금하셨다면 잠시만 기다려 주세요"
+			}
+			session.publish(MsgTypePaymentStatus, status)
+
+			// 상태 로깅
+			if check.Health != nil && check.Health.Degraded() {
+				log.Printf("결제 확인 대기 #%d - ID: %s, KIS 회로 차단기: %s, 오류: %s\n", attempt, paymentID, check.Health.Circuit, check.Health.LastError)
+			} else if check.LastError != nil {
+				log.Printf("결제 확인 대기 #%d - ID: %s, 예수금 조회 오류: %v\n", attempt, paymentID, check.LastError)
+			} else {
+				log.Printf("결제 확인 대기 #%d - ID: %s, 예상 증가액: %s원, 현재 예수금: %s원\n",
+					attempt, paymentID, utils.FormatNumber(amount), utils.FormatNumber(check.Balance))
+			}
+		}
+	}
+
+	// 결과 전송
+	if success {
+		orderStatus = models.OrderStatusPaid
+		paymentStatus = models.PaymentStatusSucceeded
+		response = models.PaymentResponse{
+			Success: true,
+			Message: "결제가 성공적으로 확인되었습니다",
+			Details: map[string]interface{}{
+				"payment_id":      paymentID,
+				"order_id":        order.ID,
+				"expected_amount": amount,
+				"actual_change":   actualChange,
+				"refund_due":      refundDue,
+				"verified_at":     time.Now().Format(time.RFC3339),
+				"elapsed_time":    time.Since(startTime).String(),
+			},
+		}
+	} else {
+		// 결제 실패 로깅
+		timeout := int((deadline.Sub(startTime) - paused) / time.Second)
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventMessage, Level: utils.PaymentLogWarn, PaymentID: paymentID, OrderID: order.ID,
+			Expected: amount, Received: actualChange, Attempt: attempts},
+			"[중요] 결제 실패 - ID: %s, 요청 금액: %s원, 최종 변동액: %s원, 타임아웃: %v초",
+			paymentID, utils.FormatNumber(amount), utils.FormatNumber(actualChange), timeout)
+
+		orderStatus = models.OrderStatusExpired
+		paymentStatus = models.PaymentStatusTimeout
+		failureReason = "결제 확인 시간 초과"
+		message := "결제 확인 시간 초과"
+		if actualChange > 0 {
+			// 부족 입금 후 추가 입금 없이 만료 - 입금된 금액은 환불 대상
+			paymentStatus = models.PaymentStatusUnderpaid
+			refundDue = actualChange
+			failureReason = fmt.Sprintf("부족 입금 후 시간 초과 (환불 필요: %s원)", utils.FormatNumber(refundDue))
+			message = fmt.Sprintf("입금액이 부족합니다 (%s원 중 %s원 입금). 입금하신 금액은 환불해 드립니다",
+				utils.FormatNumber(amount), utils.FormatNumber(actualChange))
+		}
+		response = models.PaymentResponse{
+			Success: false,
+			Message: message,
+			Details: map[string]interface{}{
+				"payment_id":      paymentID,
+				"order_id":        order.ID,
+				"expected_amount": amount,
+				"actual_change":   actualChange,
+				"refund_due":      refundDue,
+				"timeout_after":   fmt.Sprintf("%d초", timeout),
+				"elapsed_time":    time.Since(startTime).String(),
+			},
+		}
+	}
+}
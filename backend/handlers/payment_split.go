@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 분할 결제
+// 한 주문을 여러 결제(계좌 이체 여러 번, 일부 현금 등)로 나누어 받을 수 있습니다.
+// 결제 한 건 한 건은 지금처럼 따로 확인되며(이체는 예수금 감시, 현금은 직원 확인),
+// 성공한 결제 금액(오프셋 제외)의 합계가 주문 금액에 도달해야 주문이 결제 완료로 전환됩니다.
+
+// legAmount 결제 한 건이 주문 금액에서 차지하는 금액 (오프셋, 초과 입금 제외)
+func legAmount(payment models.Payment) int64 {
+	return payment.ExpectedAmount - payment.AmountOffset
+}
+
+// orderPaidLegs 주문의 성공한 결제 합계와 결제 수단 (excludePaymentID는 제외)
+func orderPaidLegs(orderID uint, excludePaymentID string) (paid int64, methods []string, err error) {
+	var payments []models.Payment
+	if err := database.DB.Where("order_id = ? AND status = ? AND payment_id <> ?", orderID, models.PaymentStatusSucceeded, excludePaymentID).
+		Find(&payments).Error; err != nil {
+		return 0, nil, err
+	}
+	seen := make(map[string]bool)
+	for _, payment := range payments {
+		paid += legAmount(payment)
+		if !seen[payment.Method] {
+			seen[payment.Method] = true
+			methods = append(methods, payment.Method)
+		}
+	}
+	return paid, methods, nil
+}
+
+// orderRemaining 주문에서 아직 결제되지 않은 금액
+func orderRemaining(order models.Order) (int64, error) {
+	paid, _, err := orderPaidLegs(order.ID, "")
+	if err != nil {
+		return 0, err
+	}
+	return int64(order.TotalPrice) - paid, nil
+}
+
+// legAmountFor 요청한 결제 금액을 확인합니다 (0이면 남은 금액 전체)
+func legAmountFor(order models.Order, requested int64) (int64, error) {
+	remaining, err := orderRemaining(order)
+	if err != nil {
+		return 0, err
+	}
+	if remaining <= 0 {
+		return 0, fmt.Errorf("이미 주문 금액만큼 결제되었습니다")
+	}
+	if requested == 0 {
+		return remaining, nil
+	}
+	if requested < 0 || requested > remaining {
+		return 0, fmt.Errorf("결제 금액은 남은 금액(%s원) 이하여야 합니다: %s원", utils.FormatNumber(remaining), utils.FormatNumber(requested))
+	}
+	return requested, nil
+}
+
+// settleOrderLeg 성공한 결제 한 건(leg, 저장 전이어도 됨)을 반영하여, 성공한 결제 합계가 주문 금액에 도달하면
+// 주문을 결제 완료로 전환하고 남은 금액을 반환합니다. 아직 남은 금액이 있으면 주문은 결제 대기 상태로 둡니다.
+func settleOrderLeg(orderID uint, leg models.Payment) (models.Order, int64, error) {
+	var order models.Order
+	if err := database.DB.First(&order, orderID).Error; err != nil {
+		return order, 0, err
+	}
+
+	paid, methods, err := orderPaidLegs(orderID, leg.PaymentID)
+	if err != nil {
+		return order, 0, err
+	}
+	paid += legAmount(leg)
+	if remaining := int64(order.TotalPrice) - paid; remaining > 0 {
+		// 일부만 결제됨 - 다음 결제를 받을 수 있도록 결제 대기 상태 유지
+		if order.Status != models.OrderStatusPendingPayment {
+			if order, err = transitionOrderStatus(orderID, models.OrderStatusPendingPayment); err != nil {
+				return order, remaining, err
+			}
+		}
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventSplitPayment, PaymentID: leg.PaymentID, OrderID: orderID,
+			Status: leg.Method, Amount: legAmount(leg), Expected: int64(order.TotalPrice), Received: paid},
+			"[분할 결제] 일부 결제 확인 - 주문 ID: %d, 결제 ID: %s, 수단: %s, 금액: %s원, 결제된 금액: %s원 / %s원",
+			orderID, leg.PaymentID, leg.Method, utils.FormatNumber(legAmount(leg)), utils.FormatNumber(paid), utils.FormatNumber(int64(order.TotalPrice)))
+		return order, remaining, nil
+	}
+
+	// 모든 결제의 수단이 같으면 그 수단, 다르면 분할 결제
+	method := leg.Method
+	for _, m := range methods {
+		if m != leg.Method {
+			method = models.PaymentMethodSplit
+		}
+	}
+	order, err = markOrderPaid(orderID, method)
+	return order, 0, err
+}
+
+// partialPaymentResponse 성공했지만 주문 금액이 남은 결제(분할 결제의 일부)의 결과 메시지
+func partialPaymentResponse(response *models.PaymentResponse, remaining int64) {
+	if response.Details == nil {
+		response.Details = make(map[string]interface{})
+	}
+	response.Details["order_paid"] = false
+	response.Details["order_remaining"] = remaining
+	response.Message = fmt.Sprintf("부분 결제가 확인되었습니다. 남은 금액: %s원", utils.FormatNumber(remaining))
+}
+
+// GetOrderPayments 주문의 결제 목록과 결제된 금액, 남은 금액 (분할 결제 진행 상황)
+func GetOrderPayments(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var payments []models.Payment
+	if err := database.DB.Where("order_id = ?", order.ID).Order("started_at asc").Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var paid int64
+	for _, payment := range payments {
+		if payment.Status == models.PaymentStatusSucceeded {
+			paid += legAmount(payment)
+		}
+	}
+
+	activePaymentsMutex.Lock()
+	activePaymentID := activeOrderPayments[order.ID]
+	activePaymentsMutex.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":          order.ID,
+		"status":            order.Status,
+		"total_price":       order.TotalPrice,
+		"paid_amount":       paid,
+		"remaining":         int64(order.TotalPrice) - paid,
+		"active_payment_id": activePaymentID,
+		"payments":          payments,
+	})
+}
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 대사 불일치 유형
+const (
+	MismatchPaymentAmount      = "payment_amount"       // 결제 금액과 실제 입금액이 다름 (초과/부족 입금)
+	MismatchOrderAmount        = "order_amount"         // 성공한 결제 금액(오프셋 제외, 분할 결제는 합계)과 주문 금액이 다름
+	MismatchPaidWithoutPayment = "paid_without_payment" // 결제 완료 주문인데 성공한 결제 기록이 없음
+	MismatchPartiallyPaid      = "partially_paid"       // 분할 결제 중 일부만 결제된 채 남은 주문 (남은 금액을 받거나 취소하여 환불 필요)
+	MismatchPaymentNoDeposit   = "payment_no_deposit"   // 성공한 결제인데 관측된 예수금 변동에 할당된 기록이 없음 (재시작 중 확인 등)
+	MismatchBalanceGap         = "balance_gap"          // 연속된 예수금 관측 사이에 기록되지 않은 변동 (서버 중지 중 변동 등)
+	MismatchPaymentOverride    = "payment_override"     // 직원이 강제 성공 처리한 결제 - 할당되지 않은 입금과 맞춰봐야 함
+)
+
+// ReconciliationSummary 영업일 입금/매출 합계
+type ReconciliationSummary struct {
+	DepositIn             int64 `json:"deposit_in"`              // 관측된 입금 합계
+	DepositOut            int64 `json:"deposit_out"`             // 관측된 출금 합계 (양수)
+	MatchedDeposits       int64 `json:"matched_deposits"`        // 결제에 할당된 입금 합계
+	UnmatchedDeposits     int64 `json:"unmatched_deposits"`      // 결제에 할당되지 않은 변동 합계 (출금 포함)
+	DismissedMovements    int64 `json:"dismissed_movements"`     // 결제와 무관한 변동으로 확인된 합계
+	ConfirmedPaymentCount int   `json:"confirmed_payment_count"` // 성공한 이체 결제 수
+	ConfirmedPayments     int64 `json:"confirmed_payments"`      // 성공한 이체 결제의 실제 입금액 합계
+	CounterPaymentCount   int   `json:"counter_payment_count"`   // 카운터 결제(현금 등) 수
+	CounterPayments       int64 `json:"counter_payments"`        // 카운터 결제 금액 합계
+	OverriddenPayments    int   `json:"overridden_payments"`     // 직원이 강제 성공/실패 처리한 결제 수
+	UnderpaidPayments     int64 `json:"underpaid_payments"`      // 부족 입금으로 끝난 결제의 입금액 합계 (환불 대상)
+	PaidOrderCount        int   `json:"paid_order_count"`
+	PaidOrderTotal        int64 `json:"paid_order_total"`    // 결제 완료 주문 금액 합계 (이후 취소 포함)
+	AmountOffsets         int64 `json:"amount_offsets"`      // 성공한 결제에 더해진 금액 오프셋 합계
+	OverpaidSurplus       int64 `json:"overpaid_surplus"`    // 성공한 결제의 초과 입금액 (환불 대상)
+	OpenSplitPayments     int64 `json:"open_split_payments"` // 그날 결제 완료되지 않은 주문의 분할 결제 금액 - 그날 결제 완료된 주문의 이전 분할 결제 금액
+	DepositDifference     int64 `json:"deposit_difference"`  // 할당된 입금 - (성공 + 부족 입금 결제)
+	SalesDifference       int64 `json:"sales_difference"`    // 성공한 결제 - 오프셋 - 초과 입금 + 카운터 결제 - 미완료 분할 결제 - 결제 완료 주문 금액
+}
+
+// ReconciliationMismatch 금액 불일치 항목
+type ReconciliationMismatch struct {
+	Type       string `json:"type"`
+	OrderID    uint   `json:"order_id,omitempty"`
+	PaymentID  string `json:"payment_id,omitempty"`
+	MovementID uint   `json:"movement_id,omitempty"`
+	Expected   int64  `json:"expected"`
+	Actual     int64  `json:"actual"`
+	Difference int64  `json:"difference"`
+	Note       string `json:"note,omitempty"`
+}
+
+// ReconciliationReport 영업일 예수금-매출 대사 결과
+type ReconciliationReport struct {
+	Date              string                   `json:"date"`
+	Balanced          bool                     `json:"balanced"` // 불일치 항목이 없고 합계가 맞는지
+	Summary           ReconciliationSummary    `json:"summary"`
+	UnmatchedDeposits []models.DepositMovement `json:"unmatched_deposits"`
+	UnpaidOrders      []models.Order           `json:"unpaid_orders"`
+	Mismatches        []ReconciliationMismatch `json:"mismatches"`
+}
+
+// parseLocalDay 날짜(YYYY-MM-DD)를 서버의 로컬 시간대 기준 그날 자정과 다음 날 자정으로 변환합니다
+// 기간 조회와 리포트는 모두 이 기준으로 하루를 나눕니다.
+func parseLocalDay(date string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return start, start, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// buildReconciliation 영업일(YYYY-MM-DD)의 예수금 변동, 결제, 주문을 비교합니다
+// 영업일은 서버의 로컬 시간대 기준 자정부터 다음 날 자정까지입니다.
+func buildReconciliation(date string) (*ReconciliationReport, error) {
+	start, end, err := parseLocalDay(date)
+	if err != nil {
+		return nil, fmt.Errorf("잘못된 날짜 형식. YYYY-MM-DD 형식을 사용하세요")
+	}
+
+	report := &ReconciliationReport{
+		Date:              date,
+		UnmatchedDeposits: []models.DepositMovement{},
+		UnpaidOrders:      []models.Order{},
+		Mismatches:        []ReconciliationMismatch{},
+	}
+	summary := &report.Summary
+
+	// 관측된 예수금 변동
+	var movements []models.DepositMovement
+	if err := database.DB.Where("observed_at >= ? AND observed_at < ?", start, end).
+		Order("observed_at asc, id asc").Find(&movements).Error; err != nil {
+		return nil, err
+	}
+
+	depositedPayments := make(map[string]bool)
+	lastMovements := make(map[string]models.DepositMovement) // 제공자/입금 계좌별 마지막 관측
+	for _, movement := range movements {
+		if movement.Delta > 0 {
+			summary.DepositIn += movement.Delta
+		} else {
+			summary.DepositOut -= movement.Delta
+		}
+		summary.MatchedDeposits += movement.MatchedAmount
+		if movement.Status == models.DepositMovementDismissed {
+			// 직원이 결제와 무관한 변동으로 확인함
+			summary.DismissedMovements += movement.UnmatchedAmount
+		} else if movement.UnmatchedAmount != 0 {
+			summary.UnmatchedDeposits += movement.UnmatchedAmount
+			report.UnmatchedDeposits = append(report.UnmatchedDeposits, movement)
+		}
+		for _, paymentID := range strings.Split(movement.MatchedPaymentIDs, ",") {
+			if paymentID != "" {
+				depositedPayments[paymentID] = true
+			}
+		}
+
+		// 같은 계좌의 이전 관측 잔액과 이어지지 않으면 그 사이의 변동은 기록되지 않음
+		key := movement.Provider + "/" + movement.Account
+		if previous, ok := lastMovements[key]; ok && previous.Balance != movement.PreviousBalance {
+			report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+				Type:       MismatchBalanceGap,
+				MovementID: movement.ID,
+				Expected:   previous.Balance,
+				Actual:     movement.PreviousBalance,
+				Difference: movement.PreviousBalance - previous.Balance,
+				Note:       "이전 관측 이후 기록되지 않은 예수금 변동",
+			})
+		}
+		lastMovements[key] = movement
+	}
+
+	// 그날 끝난 결제 (성공, 부족 입금)
+	var payments []models.Payment
+	if err := database.DB.Preload("Order").
+		Where("status IN ? AND finished_at >= ? AND finished_at < ?",
+			[]string{models.PaymentStatusSucceeded, models.PaymentStatusUnderpaid}, start, end).
+		Order("finished_at asc").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	// paidToday 주문이 그날 결제 완료되었는지
+	paidToday := func(order *models.Order) bool {
+		return order != nil && order.PaidAt != nil && !order.PaidAt.Before(start) && order.PaidAt.Before(end)
+	}
+
+	paidByPayment := make(map[uint]bool)
+	var partialOrders []models.Order // 그날 일부 결제되었지만 아직 결제 완료되지 않은 주문
+	seenPartial := make(map[uint]bool)
+	for _, payment := range payments {
+		// 분할 결제 중 일부만 결제된 주문의 결제는 주문이 결제 완료되는 날의 매출에 포함
+		if payment.Status == models.PaymentStatusSucceeded && !paidToday(payment.Order) {
+			summary.OpenSplitPayments += legAmount(payment)
+			if order := payment.Order; order != nil && order.PaidAt == nil && order.Status != models.OrderStatusCancelled && !seenPartial[order.ID] {
+				seenPartial[order.ID] = true
+				partialOrders = append(partialOrders, *order)
+			}
+		}
+
+		// 카운터 결제는 예수금과 무관하므로 매출 비교에만 포함
+		if models.IsCounterPaymentMethod(payment.Method) {
+			summary.CounterPaymentCount++
+			summary.CounterPayments += payment.ActualChange
+			paidByPayment[payment.OrderID] = true
+			continue
+		}
+
+		if payment.Status == models.PaymentStatusUnderpaid {
+			summary.UnderpaidPayments += payment.ActualChange
+			continue
+		}
+
+		summary.ConfirmedPaymentCount++
+		summary.ConfirmedPayments += payment.ActualChange
+		summary.AmountOffsets += payment.AmountOffset
+		summary.OverpaidSurplus += payment.RefundDue
+		paidByPayment[payment.OrderID] = true
+
+		if payment.ActualChange != payment.ExpectedAmount {
+			report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+				Type:       MismatchPaymentAmount,
+				OrderID:    payment.OrderID,
+				PaymentID:  payment.PaymentID,
+				Expected:   payment.ExpectedAmount,
+				Actual:     payment.ActualChange,
+				Difference: payment.ActualChange - payment.ExpectedAmount,
+				Note:       fmt.Sprintf("환불 필요: %d원", payment.RefundDue),
+			})
+		}
+		if !depositedPayments[payment.PaymentID] && payment.OverriddenAt != nil {
+			report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+				Type:       MismatchPaymentOverride,
+				OrderID:    payment.OrderID,
+				PaymentID:  payment.PaymentID,
+				Expected:   payment.ActualChange,
+				Difference: -payment.ActualChange,
+				Note:       fmt.Sprintf("직원 강제 성공 처리 (%s): %s", payment.OverriddenBy, payment.OverrideReason),
+			})
+		} else if !depositedPayments[payment.PaymentID] {
+			report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+				Type:       MismatchPaymentNoDeposit,
+				OrderID:    payment.OrderID,
+				PaymentID:  payment.PaymentID,
+				Expected:   payment.ActualChange,
+				Difference: -payment.ActualChange,
+				Note:       "관측된 예수금 변동에 이 결제가 없음",
+			})
+		}
+	}
+
+	// 그날 직원이 강제 처리한 결제 (실패 처리 포함)
+	var overridden int64
+	if err := database.DB.Model(&models.Payment{}).
+		Where("overridden_at >= ? AND overridden_at < ?", start, end).Count(&overridden).Error; err != nil {
+		return nil, err
+	}
+	summary.OverriddenPayments = int(overridden)
+
+	// 그날 결제 완료된 주문 (이후 취소된 주문 포함, 매출 리포트와 같은 기준)
+	var paidOrders []models.Order
+	if err := database.DB.Where("paid_at IS NOT NULL AND paid_at >= ? AND paid_at < ?", start, end).
+		Order("paid_at asc").Find(&paidOrders).Error; err != nil {
+		return nil, err
+	}
+
+	// 결제 완료된 주문의 성공한 결제 (분할 결제는 전날 결제된 부분 포함)
+	paidOrderIDs := make([]uint, 0, len(paidOrders))
+	for _, order := range paidOrders {
+		paidOrderIDs = append(paidOrderIDs, order.ID)
+	}
+	var orderPayments []models.Payment
+	if err := database.DB.Where("order_id IN ? AND status = ?", paidOrderIDs, models.PaymentStatusSucceeded).
+		Find(&orderPayments).Error; err != nil {
+		return nil, err
+	}
+	paidByOrder := make(map[uint]int64)
+	for _, payment := range orderPayments {
+		paidByOrder[payment.OrderID] += legAmount(payment)
+		if payment.FinishedAt != nil && payment.FinishedAt.Before(start) {
+			// 전날 입금되어 전날 대사에서 미완료 결제로 집계된 금액 (분할 결제, 나중에 직원이 할당한 입금)
+			summary.OpenSplitPayments -= legAmount(payment)
+			paidByPayment[payment.OrderID] = true
+		}
+	}
+
+	for _, order := range paidOrders {
+		summary.PaidOrderCount++
+		summary.PaidOrderTotal += int64(order.TotalPrice)
+
+		if paid, ok := paidByOrder[order.ID]; ok && paid != int64(order.TotalPrice) {
+			report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+				Type:       MismatchOrderAmount,
+				OrderID:    order.ID,
+				Expected:   int64(order.TotalPrice),
+				Actual:     paid,
+				Difference: paid - int64(order.TotalPrice),
+			})
+		}
+
+		if !paidByPayment[order.ID] {
+			report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+				Type:       MismatchPaidWithoutPayment,
+				OrderID:    order.ID,
+				Expected:   int64(order.TotalPrice),
+				Difference: -int64(order.TotalPrice),
+				Note:       "그날 성공한 결제 기록이 없음",
+			})
+		}
+	}
+
+	for _, order := range partialOrders {
+		paid, _, err := orderPaidLegs(order.ID, "")
+		if err != nil {
+			return nil, err
+		}
+		report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+			Type:       MismatchPartiallyPaid,
+			OrderID:    order.ID,
+			Expected:   int64(order.TotalPrice),
+			Actual:     paid,
+			Difference: paid - int64(order.TotalPrice),
+			Note:       "분할 결제 중 남은 금액을 받지 못함 (남은 금액 결제 또는 주문 취소 후 환불 필요)",
+		})
+	}
+
+	// 그날 생성되었지만 결제되지 않은 주문
+	if err := database.DB.Where("created_at >= ? AND created_at < ? AND status IN ?", start, end,
+		[]string{models.OrderStatusPendingPayment, models.OrderStatusPaymentFailed, models.OrderStatusExpired}).
+		Order("created_at asc").Find(&report.UnpaidOrders).Error; err != nil {
+		return nil, err
+	}
+
+	summary.DepositDifference = summary.MatchedDeposits - summary.ConfirmedPayments - summary.UnderpaidPayments
+	summary.SalesDifference = summary.ConfirmedPayments - summary.AmountOffsets - summary.OverpaidSurplus + summary.CounterPayments -
+		summary.OpenSplitPayments - summary.PaidOrderTotal
+
+	report.Balanced = len(report.Mismatches) == 0 && len(report.UnmatchedDeposits) == 0 &&
+		summary.DepositDifference == 0 && summary.SalesDifference == 0
+	return report, nil
+}
+
+// reconciliationDate date 매개변수 (없으면 오늘)
+func reconciliationDate(c *gin.Context) string {
+	if date := c.Query("date"); date != "" {
+		return date
+	}
+	return time.Now().Format("2006-01-02")
+}
+
+// GetReconciliation 영업일 예수금-매출 대사 리포트
+func GetReconciliation(c *gin.Context) {
+	report, err := buildReconciliation(reconciliationDate(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportReconciliation 대사 리포트를 CSV로 내려받습니다
+func ExportReconciliation(c *gin.Context) {
+	report, err := buildReconciliation(reconciliationDate(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("reconciliation_%s.csv", strings.ReplaceAll(report.Date, "-", ""))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	// 엑셀에서 한글이 깨지지 않도록 BOM 추가
+	c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"구분", "유형", "일시", "주문 ID", "결제 ID", "예수금 변동 ID", "기대 금액", "실제 금액", "차액", "비고"})
+
+	summary := report.Summary
+	summaryRows := []struct {
+		name   string
+		amount int64
+	}{
+		{"입금 합계", summary.DepositIn},
+		{"출금 합계", summary.DepositOut},
+		{"결제 할당 입금", summary.MatchedDeposits},
+		{"미할당 변동", summary.UnmatchedDeposits},
+		{"결제 무관 변동", summary.DismissedMovements},
+		{"성공 결제 입금액", summary.ConfirmedPayments},
+		{"부족 입금 결제", summary.UnderpaidPayments},
+		{"카운터 결제", summary.CounterPayments},
+		{"결제 완료 주문 금액", summary.PaidOrderTotal},
+		{"금액 오프셋", summary.AmountOffsets},
+		{"초과 입금", summary.OverpaidSurplus},
+		{"미완료 분할 결제", summary.OpenSplitPayments},
+		{"입금 차액", summary.DepositDifference},
+		{"매출 차액", summary.SalesDifference},
+	}
+	for _, row := range summaryRows {
+		w.Write([]string{"합계", row.name, report.Date, "", "", "", "", strconv.FormatInt(row.amount, 10), "", ""})
+	}
+
+	for _, movement := range report.UnmatchedDeposits {
+		w.Write([]string{
+			"미할당 예수금 변동",
+			movement.Provider,
+			movement.ObservedAt.Format("2006-01-02 15:04:05"),
+			"",
+			movement.MatchedPaymentIDs,
+			strconv.FormatUint(uint64(movement.ID), 10),
+			"0",
+			strconv.FormatInt(movement.UnmatchedAmount, 10),
+			strconv.FormatInt(movement.UnmatchedAmount, 10),
+			fmt.Sprintf("잔액 %d → %d", movement.PreviousBalance, movement.Balance),
+		})
+	}
+
+	for _, order := range report.UnpaidOrders {
+		w.Write([]string{
+			"미결제 주문",
+			order.Status,
+			order.CreatedAt.Format("2006-01-02 15:04:05"),
+			strconv.FormatUint(uint64(order.ID), 10),
+			"",
+			"",
+			strconv.Itoa(order.TotalPrice),
+			"0",
+			strconv.Itoa(-order.TotalPrice),
+			"",
+		})
+	}
+
+	for _, mismatch := range report.Mismatches {
+		orderID := ""
+		if mismatch.OrderID != 0 {
+			orderID = strconv.FormatUint(uint64(mismatch.OrderID), 10)
+		}
+		movementID := ""
+		if mismatch.MovementID != 0 {
+			movementID = strconv.FormatUint(uint64(mismatch.MovementID), 10)
+		}
+		w.Write([]string{
+			"금액 불일치",
+			mismatch.Type,
+			"",
+			orderID,
+			mismatch.PaymentID,
+			movementID,
+			strconv.FormatInt(mismatch.Expected, 10),
+			strconv.FormatInt(mismatch.Actual, 10),
+			strconv.FormatInt(mismatch.Difference, 10),
+			mismatch.Note,
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"kiosk/database"
+	"kiosk/models"
+	"kiosk/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RefundCustomerInfo 환불 받을 고객 정보
+type RefundCustomerInfo struct {
+	CustomerName    string `json:"customer_name"`
+	CustomerContact string `json:"customer_contact"`
+	BankName        string `json:"bank_name"`
+	AccountNumber   string `json:"account_number"`
+	AccountHolder   string `json:"account_holder"`
+}
+
+// CancelOrderRequest 결제 완료된 주문 취소 요청
+type CancelOrderRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	RefundCustomerInfo
+}
+
+// CreateRefundRequest 직원 판단에 의한 환불 생성 요청
+type CreateRefundRequest struct {
+	OrderID   *uint  `json:"order_id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount" binding:"required,gt=0"`
+	Reason    string `json:"reason" binding:"required"`
+	RefundCustomerInfo
+}
+
+// CompleteRefundRequest 환불 완료 처리 요청
+type CompleteRefundRequest struct {
+	CompletedBy string `json:"completed_by"`
+	Note        string `json:"note"`
+}
+
+// createRefund 환불 기록을 생성합니다
+func createRefund(refund *models.Refund) error {
+	refund.Status = models.RefundStatusPending
+	if err := database.DB.Create(refund).Error; err != nil {
+		return err
+	}
+	var orderID uint
+	if refund.OrderID != nil {
+		orderID = *refund.OrderID
+	}
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventRefundCreated, PaymentID: refund.PaymentID, OrderID: orderID,
+		Status: refund.Source, Amount: refund.Amount},
+		"[환불] 환불 대기 등록 - ID: %d, 원인: %s, 금액: %s원, 결제 ID: %s, 사유: %s",
+		refund.ID, refund.Source, utils.FormatNumber(refund.Amount), refund.PaymentID, refund.Reason)
+	return nil
+}
+
+// recordPaymentRefund 초과/부족 입금으로 생긴 환불 대상 금액을 기록합니다
+func recordPaymentRefund(paymentID string, orderID uint, amount int64, source string, reason string) {
+	if amount <= 0 {
+		return
+	}
+	refund := &models.Refund{
+		OrderID:   &orderID,
+		PaymentID: paymentID,
+		Amount:    amount,
+		Source:    source,
+		Reason:    reason,
+	}
+	if err := createRefund(refund); err != nil {
+		logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: paymentID, OrderID: orderID, Amount: amount},
+			"[중요] 환불 기록 생성 실패 - 결제 ID: %s, 금액: %s원, 오류: %v", paymentID, utils.FormatNumber(amount), err)
+	}
+}
+
+// applyTo 비어 있지 않은 고객 정보만 환불 기록에 반영
+func (info RefundCustomerInfo) applyTo(refund *models.Refund) {
+	if info.CustomerName != "" {
+		refund.CustomerName = info.CustomerName
+	}
+	if info.CustomerContact != "" {
+		refund.CustomerContact = info.CustomerContact
+	}
+	if info.BankName != "" {
+		refund.BankName = info.BankName
+	}
+	if info.AccountNumber != "" {
+		refund.AccountNumber = info.AccountNumber
+	}
+	if info.AccountHolder != "" {
+		refund.AccountHolder = info.AccountHolder
+	}
+}
+
+// CancelPaidOrder 결제 완료된 주문을 취소하고 주문 금액의 환불 기록을 생성합니다
+func CancelPaidOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req CancelOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 확인하고 취소하는 동안 결제가 시작되지 않도록 잡아둠
+	activePaymentsMutex.Lock()
+	// 결제가 진행 중인 주문은 결제 취소로 처리해야 함
+	if activePaymentID, paying := activeOrderPayments[uint(orderID)]; paying {
+		activePaymentsMutex.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("결제가 진행 중인 주문입니다 (결제 ID: %s)", activePaymentID)})
+		return
+	}
+	order, err := transitionOrderStatus(uint(orderID), models.OrderStatusCancelled)
+	activePaymentsMutex.Unlock()
+	if err != nil {
+		if errors.Is(err, ErrInvalidOrderTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 결제 완료 전 주문은 돈을 받지 않았으므로 환불 없이 취소만 (분할 결제 중 이미 받은 금액은 환불)
+	var refund *models.Refund
+	if order.PaidAt != nil {
+		refund = &models.Refund{
+			OrderID: &order.ID,
+			Amount:  int64(order.TotalPrice),
+			Source:  models.RefundSourceOrderCancel,
+			Reason:  req.Reason,
+		}
+	} else if paid, _, err := orderPaidLegs(order.ID, ""); err == nil && paid > 0 {
+		refund = &models.Refund{
+			OrderID: &order.ID,
+			Amount:  paid,
+			Source:  models.RefundSourceSplitCancel,
+			Reason:  req.Reason,
+		}
+	}
+	if refund != nil {
+		var payment models.Payment
+		if err := database.DB.Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusSucceeded).
+			Order("finished_at desc").First(&payment).Error; err == nil {
+			refund.PaymentID = payment.PaymentID
+		}
+		req.RefundCustomerInfo.applyTo(refund)
+		if err := createRefund(refund); err != nil {
+			logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventError, Level: utils.PaymentLogError, PaymentID: refund.PaymentID, OrderID: order.ID, Amount: refund.Amount},
+				"[중요] 주문 취소 환불 기록 생성 실패 - 주문 ID: %d, 오류: %v", order.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 주방 화면에서 제거
+		if order.PaidAt != nil {
+			broadcaster <- models.Order{ID: order.ID}
+		}
+	}
+
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventOrderCancelled, OrderID: order.ID, Amount: int64(order.TotalPrice)},
+		"[환불] 주문 취소 - 주문 ID: %d, 금액: %s원, 사유: %s", order.ID, utils.FormatNumber(int64(order.TotalPrice)), req.Reason)
+	c.JSON(http.StatusOK, gin.H{
+		"order":  order,
+		"refund": refund,
+	})
+}
+
+// CreateRefund 직원 판단에 의한 환불 기록 생성
+func CreateRefund(c *gin.Context) {
+	var req CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.OrderID != nil {
+		var order models.Order
+		if err := database.DB.First(&order, *req.OrderID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+	}
+
+	refund := &models.Refund{
+		OrderID:   req.OrderID,
+		PaymentID: req.PaymentID,
+		Amount:    req.Amount,
+		Source:    models.RefundSourceManual,
+		Reason:    req.Reason,
+	}
+	req.RefundCustomerInfo.applyTo(refund)
+	if err := createRefund(refund); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, refund)
+}
+
+// refundQuery 환불 목록 필터 (status, source, start_date, end_date)
+func refundQuery(c *gin.Context, defaultStatus string) (*gorm.DB, error) {
+	query := database.DB.Model(&models.Refund{})
+
+	status := c.DefaultQuery("status", defaultStatus)
+	if status != "" && status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, _, err := parseLocalDay(startDate)
+		if err != nil {
+			return nil, fmt.Errorf("잘못된 시작일 형식. YYYY-MM-DD 형식을 사용하세요")
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		_, end, err := parseLocalDay(endDate)
+		if err != nil {
+			return nil, fmt.Errorf("잘못된 종료일 형식. YYYY-MM-DD 형식을 사용하세요")
+		}
+		query = query.Where("created_at < ?", end)
+	}
+
+	return query.Order("created_at asc"), nil
+}
+
+// GetRefunds 환불 목록 조회 (기본: 전체)
+func GetRefunds(c *gin.Context) {
+	query, err := refundQuery(c, "all")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := query.Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	for _, refund := range refunds {
+		total += refund.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":        len(refunds),
+		"total_amount": total,
+		"refunds":      refunds,
+	})
+}
+
+// GetRefund 환불 상세 조회
+func GetRefund(c *gin.Context) {
+	var refund models.Refund
+	if err := database.DB.Preload("Order.OrderItems.Menu").First(&refund, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	}
+	c.JSON(http.StatusOK, refund)
+}
+
+// UpdateRefund 환불 받을 고객 정보 수정 (자동 생성된 환불에 계좌 정보 입력 등)
+func UpdateRefund(c *gin.Context) {
+	var refund models.Refund
+	if err := database.DB.First(&refund, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	}
+
+	var info RefundCustomerInfo
+	if err := c.ShouldBindJSON(&info); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	info.applyTo(&refund)
+
+	if err := database.DB.Save(&refund).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, refund)
+}
+
+// CompleteRefund 환불 완료 처리
+func CompleteRefund(c *gin.Context) {
+	var refund models.Refund
+	if err := database.DB.First(&refund, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	}
+
+	var req CompleteRefundRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.Refund{}).
+		Where("id = ? AND status = ?", refund.ID, models.RefundStatusPending).
+		Updates(map[string]interface{}{
+			"status":       models.RefundStatusCompleted,
+			"completed_at": &now,
+			"completed_by": req.CompletedBy,
+			"note":         req.Note,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "이미 완료된 환불입니다"})
+		return
+	}
+
+	database.DB.First(&refund, refund.ID)
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventRefundCompleted, PaymentID: refund.PaymentID,
+		Status: refund.Status, Amount: refund.Amount},
+		"[환불] 환불 완료 - ID: %d, 금액: %s원, 처리자: %s", refund.ID, utils.FormatNumber(refund.Amount), req.CompletedBy)
+	c.JSON(http.StatusOK, refund)
+}
+
+// ExportRefunds 환불 목록을 CSV로 내보냅니다 (기본: 환불 대기 건)
+func ExportRefunds(c *gin.Context) {
+	query, err := refundQuery(c, models.RefundStatusPending)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := query.Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("refunds_%s.csv", time.Now().Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	// 엑셀에서 한글이 깨지지 않도록 BOM 추가
+	c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"환불 ID", "생성일시", "주문 ID", "결제 ID", "금액", "원인", "사유", "상태",
+		"고객명", "연락처", "은행", "계좌번호", "예금주", "완료일시", "처리자"})
+	for _, refund := range refunds {
+		orderID := ""
+		if refund.OrderID != nil {
+			orderID = strconv.FormatUint(uint64(*refund.OrderID), 10)
+		}
+		completedAt := ""
+		if refund.CompletedAt != nil {
+			completedAt = refund.CompletedAt.Format("2006-01-02 15:04:05")
+		}
+		w.Write([]string{
+			strconv.FormatUint(uint64(refund.ID), 10),
+			refund.CreatedAt.Format("2006-01-02 15:04:05"),
+			orderID,
+			refund.PaymentID,
+			strconv.FormatInt(refund.Amount, 10),
+			refund.Source,
+			refund.Reason,
+			refund.Status,
+			refund.CustomerName,
+			refund.CustomerContact,
+			refund.BankName,
+			refund.AccountNumber,
+			refund.AccountHolder,
+			completedAt,
+			refund.CompletedBy,
+		})
+	}
+	w.Flush()
+}
+
+// GetSalesSummary 기간별 매출 합계 (환불 반영)
+// 결제 완료 시각 기준 매출에서 주문 취소/직원 환불을 차감하며,
+// 초과/부족 입금 환불은 매출이 아닌 입금액 반환이므로 별도로 집계합니다.
+func GetSalesSummary(c *gin.Context) {
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+	if startDate == "" || endDate == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "시작일(start_date)과 종료일(end_date) 매개변수가 모두 필요합니다"})
+		return
+	}
+	start, _, err := parseLocalDay(startDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 시작일 형식. YYYY-MM-DD 형식을 사용하세요"})
+		return
+	}
+	_, end, err := parseLocalDay(endDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "잘못된 종료일 형식. YYYY-MM-DD 형식을 사용하세요"})
+		return
+	}
+
+	// 결제 완료된 주문 (이후 취소된 주문 포함)
+	var gross struct {
+		Count int64
+		Total int64
+	}
+	if err := database.DB.Model(&models.Order{}).
+		Where("paid_at IS NOT NULL AND paid_at >= ? AND paid_at < ?", start, end).
+		Select("COUNT(*) AS count, COALESCE(SUM(total_price), 0) AS total").
+		Scan(&gross).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 결제 수단별 매출 (결제 수단이 없는 주문은 계좌 이체)
+	var byMethodRows []struct {
+		Method string
+		Count  int64
+		Total  int64
+	}
+	if err := database.DB.Model(&models.Order{}).
+		Where("paid_at IS NOT NULL AND paid_at >= ? AND paid_at < ?", start, end).
+		Select("COALESCE(NULLIF(payment_method, ''), ?) AS method, COUNT(*) AS count, COALESCE(SUM(total_price), 0) AS total", models.PaymentMethodTransfer).
+		Group("method").
+		Scan(&byMethodRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	byMethod := make(map[string]gin.H, len(byMethodRows))
+	for _, row := range byMethodRows {
+		byMethod[row.Method] = gin.H{"count": row.Count, "total": row.Total}
+	}
+
+	// 기간 내 생성된 환불
+	var refunds []models.Refund
+	if err := database.DB.Where("created_at >= ? AND created_at < ?", start, end).Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var salesRefunds, depositRefunds, pendingRefunds int64
+	bySource := make(map[string]int64)
+	for _, refund := range refunds {
+		bySource[refund.Source] += refund.Amount
+		if models.RefundReducesSales(refund.Source) {
+			salesRefunds += refund.Amount
+		} else {
+			depositRefunds += refund.Amount
+		}
+		if refund.Status == models.RefundStatusPending {
+			pendingRefunds += refund.Amount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start_date":        startDate,
+		"end_date":          endDate,
+		"paid_order_count":  gross.Count,
+		"gross_sales":       gross.Total,
+		"sales_refunds":     salesRefunds,
+		"net_sales":         gross.Total - salesRefunds,
+		"deposit_refunds":   depositRefunds,
+		"pending_refunds":   pendingRefunds,
+		"refunds_by_source": bySource,
+		"sales_by_method":   byMethod,
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"kiosk/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SimulatorDepositRequest 시뮬레이터 입금 요청
+// payment_id를 지정하면 해당 결제가 배정된 계좌에 입금 금액만큼, 아니면 account(비어 있으면 기본 계좌)에 amount만큼 입금합니다.
+type SimulatorDepositRequest struct {
+	PaymentID string `json:"payment_id"`
+	Account   string `json:"account"`
+	Amount    int64  `json:"amount"`
+}
+
+// getSimulator 현재 결제 제공자가 시뮬레이터인지 확인
+func getSimulator(c *gin.Context) (*utils.SimulatorProvider, bool) {
+	providerInterface, _ := c.Get("paymentProvider")
+	simulator, ok := providerInterface.(*utils.SimulatorProvider)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "시뮬레이터 결제 제공자가 활성화되어 있지 않습니다 (PAYMENT_PROVIDER=simulator)"})
+		return nil, false
+	}
+	return simulator, true
+}
+
+// GetSimulatorState 시뮬레이터 가상 계좌별 잔액과 입금 대기 결제 조회
+func GetSimulatorState(c *gin.Context) {
+	simulator, ok := getSimulator(c)
+	if !ok {
+		return
+	}
+
+	accounts := simulator.Accounts()
+	states := make([]gin.H, 0, len(accounts))
+	for _, account := range accounts {
+		balance, _ := simulator.Balance(account.ID)
+		states = append(states, gin.H{
+			"id":               account.ID,
+			"balance":          balance,
+			"observed_balance": account.Balance,
+			"pending":          account.Pending,
+		})
+	}
+
+	primary := states[0]
+	c.JSON(http.StatusOK, gin.H{
+		"balance":          primary["balance"],
+		"observed_balance": primary["observed_balance"],
+		"pending":          primary["pending"],
+		"accounts":         states,
+	})
+}
+
+// SimulatorDeposit 시뮬레이터 계좌에 입금
+func SimulatorDeposit(c *gin.Context) {
+	simulator, ok := getSimulator(c)
+	if !ok {
+		return
+	}
+
+	var req SimulatorDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	amount := req.Amount
+	account := req.Account
+	if req.PaymentID != "" {
+		var err error
+		if account, amount, err = simulator.DepositFor(req.PaymentID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	} else if amount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payment_id 또는 amount가 필요합니다"})
+		return
+	} else if _, err := simulator.Deposit(account, amount); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, _ := simulator.Balance(account)
+	logPaymentEvent(utils.PaymentLogEvent{Type: PaymentEventSimulator, PaymentID: req.PaymentID, Account: account,
+		Amount: amount, DepositAfter: depositValue(balance)},
+		"[시뮬레이터] 입금 - 계좌: %s, 금액: %s원, 결제 ID: %s, 잔액: %s원",
+		account, utils.FormatNumber(amount), req.PaymentID, utils.FormatNumber(balance))
+
+	c.JSON(http.StatusOK, gin.H{
+		"payment_id": req.PaymentID,
+		"account":    account,
+		"amount":     amount,
+		"balance":    balance,
+	})
+}
@@ -10,40 +10,79 @@ import (
 	"sync"
 	// "net/http"
 	"os"
+	"strconv"
 	"strings"
 	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
 
 	"github.com/gin-gonic/gin"
 	// "github.com/gin-contrib/static"
 	"github.com/joho/godotenv"
 )
 
-var depositState *utils.DepositState
+// setupKISApi 입금 계좌 하나의 KIS API 클라이언트를 생성하고 토큰을 발급받습니다
+func setupKISApi(ctx context.Context, wg *sync.WaitGroup, kisConfig utils.KISConfig, tokenCachePath string) *utils.KISApi {
+	kisApi := utils.NewKISApiFromConfig(kisConfig)
+	log.Printf("KIS 환경: %s, 주소: %s, 계좌: %s", kisConfig.Env, kisConfig.BaseURL, kisConfig.MaskedAccount())
 
-// refreshToken handles the periodic token refresh process
-func refreshTokenPeriodically(ctx context.Context, kisApi *utils.KISApi, wg *sync.WaitGroup) {
-	defer wg.Done()
-	
-	ticker := time.NewTicker(12 * time.Hour)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-ticker.C:
-			log.Println("토큰 재발급 시도 중...")
-			success, err := kisApi.GetAccessToken()
-			if !success || err != nil {
-				log.Printf("토큰 재발급 실패: %v", err)
-				// 실패해도 계속 진행
-				continue
-			}
-			log.Println("KIS API 토큰 재발급 성공")
-			
-		case <-ctx.Done():
-			log.Println("토큰 재발급 고루틴 종료")
-			return
+	// 토큰 캐시 (재시작 시 유효한 토큰을 다시 사용하여 불필요한 발급을 줄임)
+	if tokenCachePath != "off" {
+		if err := kisApi.Tokens().SetCachePath(tokenCachePath); err != nil {
+			log.Printf("토큰 캐시를 불러오지 못했습니다: %v", err)
 		}
 	}
+
+	// 토큰 발급 (저장된 토큰이 유효하면 그대로 사용)
+	if success, err := kisApi.GetAccessToken(); !success || err != nil {
+		log.Fatalf("Failed to get KIS API token (%s): %v", kisConfig.MaskedAccount(), err)
+	}
+	log.Printf("KIS API token obtained successfully (%s)", kisConfig.MaskedAccount())
+	
+	// 만료 전 선제 재발급 고루틴 시작
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		kisApi.Tokens().Run(ctx)
+	}()
+
+	return kisApi
+}
+
+// accountTokenCachePath n번 계좌의 토큰 캐시 경로 (기본 계좌는 그대로, 추가 계좌는 kis_token_2.json 형식)
+func accountTokenCachePath(path string, n int) string {
+	if path == "off" || n == 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// importPaymentLogs 구조화된 결제 로그 이전의 텍스트 로그(logs/payment_*.log)를 결제 기록으로 가져옵니다
+//
+//	kiosk import-payment-logs [-dir logs] [-dry-run]
+func importPaymentLogs(args []string) {
+	flags := flag.NewFlagSet("import-payment-logs", flag.ExitOnError)
+	dir := flags.String("dir", "logs", "payment_YYYY-MM-DD.log 파일이 있는 디렉토리")
+	dryRun := flags.Bool("dry-run", false, "저장하지 않고 가져올 기록 수만 확인")
+	flags.Parse(args)
+
+	summary, err := handlers.ImportLegacyPaymentLogs(*dir, *dryRun)
+	if err != nil {
+		log.Fatalf("결제 로그 가져오기 실패: %v", err)
+	}
+
+	prefix := ""
+	if *dryRun {
+		prefix = "[확인만] "
+	}
+	log.Printf("%s파일 %d개, 기록 %d줄 (알아볼 수 없는 줄 %d개)", prefix, summary.Files, summary.Entries, summary.UnrecognizedRows)
+	log.Printf("%s결제 기록 %d건 저장 (이미 가져온 기록 %d건 건너뜀)", prefix, summary.Payments, summary.AlreadyImported)
+	if summary.DepositWarnings > 0 {
+		log.Printf("%s예수금 불일치 경고 %d건은 예수금 변동으로 저장하지 않았습니다 (결제 ID가 있는 경고는 결제 기록 메모에 남김)",
+			prefix, summary.DepositWarnings)
+	}
 }
 
 func main() {
@@ -57,44 +96,179 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// 하위 명령 (서버를 시작하지 않음)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-payment-logs":
+			importPaymentLogs(os.Args[2:])
+			return
+		default:
+			log.Fatalf("알 수 없는 명령: %s (import-payment-logs)", os.Args[1])
+		}
+	}
+
 	// 기본 카테고리 생성
 	database.InitializeCategories()
 
-	// KIS API 설정
-	appKey := os.Getenv("KIS_APP_KEY")
-	appSecret := os.Getenv("KIS_APP_SECRET")
-	accountNo := os.Getenv("KIS_ACCOUNT_NO")
-	accountProdCode := os.Getenv("KIS_ACCOUNT_PROD_CODE")
+	// 토큰 주기적 재발급을 위한 컨텍스트 및 WaitGroup 설정
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
 
-	if appKey == "" || appSecret == "" || accountNo == "" {
-		log.Fatal("KIS API credentials are not set in environment variables")
+	// 입금 계좌 (결제 QR 코드와 딥링크)
+	var payee *utils.PayeeConfig
+	if payeeConfig, err := utils.LoadPayeeConfigFromEnv(); err != nil {
+		log.Printf("[주의] 결제 QR 코드를 사용할 수 없습니다: %v", err)
+	} else {
+		payee = &payeeConfig
+		log.Printf("입금 계좌: %s %s", payee.BankName, payee.AccountNo)
 	}
 
-	kisApi := utils.NewKISApi(appKey, appSecret, accountNo, accountProdCode)
-	
-	// 토큰 발급
-	if success, err := kisApi.GetAccessToken(); !success || err != nil {
-		log.Fatalf("Failed to get KIS API token: %v", err)
+	// 결제 제공자 설정 (kis: KIS 계좌 예수금 감시, simulator: KIS 없이 개발/시연)
+	var kisApi *utils.KISApi
+	var depositProvider *utils.DepositProvider
+	var paymentProvider utils.PaymentProvider
+
+	providerName := os.Getenv("PAYMENT_PROVIDER")
+	if providerName == "" {
+		providerName = utils.ProviderKIS
+	}
+
+	switch providerName {
+	case utils.ProviderKIS:
+		// KIS API 설정 (환경, 주소, tr_id, 계좌별 인증 정보, 클라이언트 옵션)
+		kisConfigs, err := utils.LoadKISAccountConfigsFromEnv()
+		if err != nil {
+			log.Fatalf("KIS 설정 오류: %v (PAYMENT_PROVIDER=simulator로 KIS 없이 실행할 수 있습니다)", err)
+		}
+
+		tokenCachePath := os.Getenv("KIS_TOKEN_CACHE")
+		if tokenCachePath == "" {
+			tokenCachePath = "kis_token.json"
+		}
+
+		// 입금 계좌가 여러 개이면 결제마다 대기 결제가 적은 계좌로 나누어 받음
+		accounts := make([]*utils.DepositAccount, 0, len(kisConfigs))
+		for i, kisConfig := range kisConfigs {
+			api := setupKISApi(ctx, &wg, kisConfig, accountTokenCachePath(tokenCachePath, i+1))
+			if kisApi == nil {
+				kisApi = api
+			}
+			account := utils.NewDepositAccount(kisConfig.AccountID(), kisConfig.MaskedAccount(), api)
+			// 추가 계좌의 QR 코드 입금 계좌 (PAYEE_ACCOUNT_NO_2, 없으면 KIS 계좌번호)
+			if i > 0 && payee != nil {
+				accountNo := os.Getenv(fmt.Sprintf("PAYEE_ACCOUNT_NO_%d", i+1))
+				if accountNo == "" {
+					accountNo = kisConfig.AccountID()
+				}
+				account.Payee = payee.ForAccount(accountNo)
+			}
+			accounts = append(accounts, account)
+		}
+		depositProvider = utils.NewDepositProvider(utils.ProviderKIS, accounts...)
+		paymentProvider = depositProvider
+		if len(accounts) > 1 {
+			log.Printf("입금 계좌 %d개로 결제를 나누어 받습니다", len(accounts))
+		}
+
+	case utils.ProviderSimulator:
+		var initialBalance int64
+		if balance := os.Getenv("SIMULATOR_INITIAL_BALANCE"); balance != "" {
+			var err error
+			if initialBalance, err = strconv.ParseInt(balance, 10, 64); err != nil {
+				log.Fatalf("SIMULATOR_INITIAL_BALANCE 값이 올바르지 않습니다: %s", balance)
+			}
+		}
+		accountCount := 1
+		if count := os.Getenv("SIMULATOR_ACCOUNTS"); count != "" {
+			var err error
+			if accountCount, err = strconv.Atoi(count); err != nil || accountCount < 1 {
+				log.Fatalf("SIMULATOR_ACCOUNTS 값이 올바르지 않습니다: %s", count)
+			}
+		}
+		simulator := utils.NewSimulatorProvider(initialBalance, accountCount)
+		depositProvider = simulator.DepositProvider
+		paymentProvider = simulator
+		log.Println("[시뮬레이터] 결제 시뮬레이터 모드로 실행합니다. 입금은 POST /api/admin/simulator/deposits 로 발생시킬 수 있습니다.")
+
+	default:
+		log.Fatalf("알 수 없는 PAYMENT_PROVIDER: %s (kis 또는 simulator)", providerName)
 	}
-	log.Println("KIS API token obtained successfully")
-	
-	// 토큰 주기적 재발급을 위한 컨텍스트 및 WaitGroup 설정
-	ctx, cancel := context.WithCancel(context.Background())
-	var wg sync.WaitGroup
-	
-	// 토큰 재발급 고루틴 시작
-	wg.Add(1)
-	go refreshTokenPeriodically(ctx, kisApi, &wg)
 
 	// 예수금 상태 관리 초기화
-	depositState = utils.NewDepositState(kisApi)
-	if err := depositState.Initialize(); err != nil {
+	if err := depositProvider.Initialize(); err != nil {
 		log.Fatalf("예수금 상태 초기화 실패: %v", err)
 	}
-	log.Printf("현재 예수금: %s원", utils.FormatNumber(depositState.GetCurrentDeposit()))
+	for _, account := range depositProvider.Accounts() {
+		log.Printf("현재 예수금 (%s): %s원", account.Label, utils.FormatNumber(account.Balance))
+	}
+
+	// 동시 결제 구분용 금액 오프셋 (예: 9이면 주문 금액에 0~9원을 더해 대기 중인 결제끼리 금액이 겹치지 않게 함)
+	if offsetMax := os.Getenv("PAYMENT_AMOUNT_OFFSET_MAX"); offsetMax != "" {
+		maxOffset, err := strconv.ParseInt(offsetMax, 10, 64)
+		if err != nil || maxOffset < 0 {
+			log.Fatalf("PAYMENT_AMOUNT_OFFSET_MAX 값이 올바르지 않습니다: %s", offsetMax)
+		}
+		depositProvider.SetMaxAmountOffset(maxOffset)
+		log.Printf("결제 금액 오프셋 사용: 최대 %d원", maxOffset)
+	}
 
-    // 로그 시스템 초기화
-    if err := handlers.InitLogSystem(); err != nil {
+	// 금액이 다른 입금을 하나뿐인 대기 결제에 할당할 허용 범위 (%, 벗어나면 직원 확인이 필요한 변동으로 남김)
+	if tolerance := os.Getenv("PAYMENT_MATCH_TOLERANCE_PERCENT"); tolerance != "" {
+		percent, err := strconv.ParseInt(tolerance, 10, 64)
+		if err != nil || percent < 0 {
+			log.Fatalf("PAYMENT_MATCH_TOLERANCE_PERCENT 값이 올바르지 않습니다: %s", tolerance)
+		}
+		depositProvider.SetMatchTolerance(percent)
+	}
+
+	// 예수금 조회 간격 (입금 대기 정책 파일이 없을 때 모든 구간에 적용)
+	pollInterval := utils.DefaultDepositPollInterval
+	if value := os.Getenv("DEPOSIT_POLL_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			log.Fatalf("DEPOSIT_POLL_INTERVAL 값이 올바르지 않습니다: %s", value)
+		}
+		pollInterval = interval
+	}
+	depositProvider.SetPollInterval(pollInterval)
+
+	// 입금 대기 정책 (조회 간격 곡선, 대기 시간, 유예 시간) - 관리자가 PUT /api/admin/payment-policy 로 바꾸면 파일에 저장됨
+	policyPath := os.Getenv("PAYMENT_POLICY_FILE")
+	if policyPath == "" {
+		policyPath = "payment_policy.json"
+	}
+	policyStore, err := utils.LoadPaymentPolicy(policyPath, utils.DefaultPaymentPolicy(pollInterval))
+	if err != nil {
+		log.Fatalf("입금 대기 정책을 읽을 수 없습니다: %v", err)
+	}
+	policy := policyStore.Get()
+	log.Printf("입금 대기 정책: 대기 시간 %v, 유예 시간 %v, 조회 구간 %d개",
+		time.Duration(policy.Timeout), time.Duration(policy.GracePeriod), len(policy.Schedule))
+	depositProvider.SetPollSchedule(policyStore.PollInterval)
+	handlers.SetPaymentPolicy(policyStore)
+
+	// 주문/결제 요청 키 보관 기간 (이 기간 안에 같은 Idempotency-Key로 다시 오면 처음 결과를 돌려줌)
+	if value := os.Getenv("IDEMPOTENCY_KEY_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil || retention <= 0 {
+			log.Fatalf("IDEMPOTENCY_KEY_RETENTION 값이 올바르지 않습니다: %s", value)
+		}
+		handlers.SetIdempotencyRetention(retention)
+	}
+
+	// 예수금 폴러 시작 (계좌별로 입금 대기 중인 결제가 있을 때만 KIS 잔고 조회)
+	depositProvider.StartPolling(ctx)
+
+    // 로그 시스템 초기화 (날짜별 JSON Lines 결제 로그, 보관 기간이 지난 파일은 삭제)
+    retentionDays := 90
+    if retention := os.Getenv("PAYMENT_LOG_RETENTION_DAYS"); retention != "" {
+        days, err := strconv.Atoi(retention)
+        if err != nil || days < 0 {
+            log.Fatalf("PAYMENT_LOG_RETENTION_DAYS 값이 올바르지 않습니다: %s", retention)
+        }
+        retentionDays = days
+    }
+    if err := handlers.InitLogSystem(retentionDays); err != nil {
         log.Fatalf("로그 시스템 초기화 실패: %v", err)
     }
     defer handlers.CloseLogSystem()
@@ -102,6 +276,14 @@ func main() {
     // SSE 브로드캐스터 시작
     handlers.StartSSEBroadcaster()
 
+	// 예수금 변동 기록 (일별 대사 리포트)
+	handlers.StartDepositRecorder(paymentProvider)
+
+	// 재시작 전에 끝나지 않은 결제 복구 (입금 확인, 대기 재개 또는 직원 확인 표시)
+	if err := handlers.RecoverPayments(paymentProvider); err != nil {
+		log.Printf("결제 복구 실패: %v", err)
+	}
+
 	// Gin 라우터 설정
 	r := gin.Default()
 	
@@ -111,8 +293,11 @@ func main() {
 	// KIS API 미들웨어 설정
 	r.Use(func(c *gin.Context) {
 		if strings.HasPrefix(c.Request.URL.Path, "/api") {
-			c.Set("kisApi", kisApi)
-			c.Set("depositState", depositState)
+			if kisApi != nil {
+				c.Set("kisApi", kisApi)
+			}
+			c.Set("paymentProvider", paymentProvider)
+			c.Set("payee", payee)
 		}
 		c.Next()
 	})
@@ -25,11 +25,69 @@ type Menu struct {
 }
 
 type Order struct {
-    ID         uint        `gorm:"primaryKey" json:"id"`
-    TotalPrice int         `gorm:"not null" json:"total_price"`
-    CreatedAt  time.Time   `json:"created_at"`
-    UpdatedAt  time.Time   `json:"updated_at"`
-    OrderItems []OrderItem `gorm:"foreignKey:OrderID" json:"order_items,omitempty"`
+    ID             uint        `gorm:"primaryKey" json:"id"`
+    TotalPrice     int         `gorm:"not null" json:"total_price"`
+    Status         string      `gorm:"not null;default:paid;index" json:"status"` // 기존 주문은 결제 완료 후 생성되었으므로 기본값은 paid
+    PaidAt         *time.Time  `json:"paid_at,omitempty"`
+    PaymentMethod  string      `gorm:"index" json:"payment_method,omitempty"` // 결제 완료 시 결제 수단 (비어 있으면 계좌 이체)
+    IdempotencyKey string      `gorm:"index" json:"idempotency_key,omitempty"` // 주문 생성 요청 키 (재전송된 요청이면 이 주문을 돌려줌)
+    CreatedAt      time.Time   `json:"created_at"`
+    UpdatedAt      time.Time   `json:"updated_at"`
+    OrderItems     []OrderItem `gorm:"foreignKey:OrderID" json:"order_items,omitempty"`
+}
+
+// 주문 상태
+const (
+    OrderStatusPendingPayment = "pending_payment" // 결제 대기
+    OrderStatusPaid           = "paid"            // 결제 완료 (주방으로 전달)
+    OrderStatusPaymentFailed  = "payment_failed"  // 결제 오류
+    OrderStatusCancelled      = "cancelled"       // 취소
+    OrderStatusExpired        = "expired"         // 결제 시간 초과
+)
+
+// 결제 수단
+const (
+    PaymentMethodTransfer = "transfer" // 계좌 이체 (예수금 감시로 확인)
+    PaymentMethodCash     = "cash"     // 카운터 현금 결제 (직원 확인)
+    PaymentMethodManual   = "manual"   // 그 밖의 직원 확인 결제 (외부 카드 단말기, 서비스 등)
+    PaymentMethodSplit    = "split"    // 서로 다른 수단으로 나누어 결제한 주문 (주문의 결제 수단으로만 사용)
+)
+
+// IsCounterPaymentMethod 직원이 카운터에서 확인하는 결제 수단인지 (예수금 변동과 무관)
+func IsCounterPaymentMethod(method string) bool {
+    return method == PaymentMethodCash || method == PaymentMethodManual
+}
+
+// orderTransitions 주문 상태별 허용되는 다음 상태
+var orderTransitions = map[string][]string{
+    OrderStatusPendingPayment: {OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusCancelled, OrderStatusExpired},
+    OrderStatusPaymentFailed:  {OrderStatusPendingPayment, OrderStatusPaid, OrderStatusCancelled},
+    OrderStatusExpired:        {OrderStatusPendingPayment, OrderStatusPaid, OrderStatusCancelled}, // 시간 초과 후 늦게 들어온 입금을 직원이 할당하면 paid
+    OrderStatusPaid:           {OrderStatusCancelled}, // 결제 완료 후 취소 시 환불 기록 생성
+}
+
+// CanTransitionOrder 주문 상태 전이가 허용되는지 확인
+func CanTransitionOrder(from, to string) bool {
+    for _, next := range orderTransitions[from] {
+        if next == to {
+            return true
+        }
+    }
+    return false
+}
+
+// OrderStatusesFrom 지정한 상태로 전이할 수 있는 이전 상태 목록
+func OrderStatusesFrom(to string) []string {
+    var froms []string
+    for from, nexts := range orderTransitions {
+        for _, next := range nexts {
+            if next == to {
+                froms = append(froms, from)
+                break
+            }
+        }
+    }
+    return froms
 }
 
 type OrderItem struct {
@@ -44,6 +102,118 @@ type OrderItem struct {
     Order     Order     `gorm:"foreignKey:OrderID" json:"order,omitempty"`
 }
 
+// Payment 결제 시도 기록 (결제 세션 하나당 한 건)
+type Payment struct {
+    ID              uint       `gorm:"primaryKey" json:"id"`
+    PaymentID       string     `gorm:"uniqueIndex;not null" json:"payment_id"`
+    OrderID         uint       `gorm:"index" json:"order_id"`
+    ExpectedAmount  int64      `gorm:"not null" json:"expected_amount"` // 입금되어야 할 금액 (오프셋 포함)
+    AmountOffset    int64      `json:"amount_offset"`                     // 동시 결제 구분을 위해 주문 금액에 더한 금액
+    Provider        string     `json:"provider"`                          // 결제 제공자 (kis, simulator, 카운터 결제는 결제 수단)
+    Account         string     `gorm:"index" json:"account,omitempty"`    // 입금받은 계좌 ID (비어 있으면 기본 계좌)
+    Method          string     `gorm:"default:transfer;index" json:"method"` // 결제 수단
+    DepositBaseline int64      `json:"deposit_baseline"`                  // 결제 시작 시점의 예수금 (재시작 후 복구 기준)
+    ActualChange    int64      `json:"actual_change"`                     // 이 결제에 할당된 입금액 합계
+    RefundDue       int64      `json:"refund_due"`                        // 고객에게 돌려줘야 할 금액 (초과 입금, 미완료 부족 입금)
+    Status          string     `gorm:"not null;index" json:"status"`
+    Attempts        int        `json:"attempts"`
+    StartedAt       time.Time  `gorm:"index" json:"started_at"`
+    FinishedAt      *time.Time `json:"finished_at,omitempty"`
+    CancelReason    string     `json:"cancel_reason,omitempty"` // 취소/실패/확인 필요 사유
+    TenderedAmount  int64      `json:"tendered_amount,omitempty"` // 현금 결제 시 받은 금액
+    ChangeDue       int64      `json:"change_due,omitempty"`      // 현금 결제 시 거스름돈
+    ConfirmedBy     string     `json:"confirmed_by,omitempty"`    // 카운터 결제를 확인한 직원
+    OverriddenBy    string     `json:"overridden_by,omitempty"`   // 진행 중인 결제를 강제 성공/실패 처리한 직원
+    OverriddenAt    *time.Time `gorm:"index" json:"overridden_at,omitempty"`
+    OverrideReason  string     `json:"override_reason,omitempty"`
+    Note            string     `json:"note,omitempty"`
+    IdempotencyKey  string     `gorm:"index" json:"idempotency_key,omitempty"` // 결제 시작 요청 키 (재전송된 요청이면 이 결제를 돌려줌)
+    CreatedAt       time.Time  `json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+    Order           *Order     `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+}
+
+// 결제 상태
+const (
+    PaymentStatusPending   = "pending"   // 입금 확인 중
+    PaymentStatusSucceeded = "succeeded" // 결제 성공
+    PaymentStatusFailed    = "failed"    // 오류로 실패
+    PaymentStatusCancelled = "cancelled" // 사용자 취소
+    PaymentStatusTimeout   = "timeout"   // 확인 시간 초과
+    PaymentStatusUnderpaid = "underpaid" // 부족 입금 후 추가 입금 없이 종료 (입금액 환불 필요)
+    PaymentStatusReview    = "review"    // 서버 재시작 후 자동으로 확인할 수 없어 직원 확인 필요
+)
+
+// Refund 고객에게 돌려줘야 할 금액 (환불 대장)
+type Refund struct {
+    ID              uint       `gorm:"primaryKey" json:"id"`
+    OrderID         *uint      `gorm:"index" json:"order_id,omitempty"`
+    PaymentID       string     `gorm:"index" json:"payment_id,omitempty"`
+    Amount          int64      `gorm:"not null" json:"amount"`
+    Source          string     `gorm:"not null;index" json:"source"` // 환불 발생 원인
+    Reason          string     `json:"reason"`
+    Status          string     `gorm:"not null;index" json:"status"`
+    CustomerName    string     `json:"customer_name"`
+    CustomerContact string     `json:"customer_contact"`
+    BankName        string     `json:"bank_name"`
+    AccountNumber   string     `json:"account_number"`
+    AccountHolder   string     `json:"account_holder"`
+    CompletedAt     *time.Time `json:"completed_at,omitempty"`
+    CompletedBy     string     `json:"completed_by,omitempty"`
+    Note            string     `json:"note,omitempty"`
+    CreatedAt       time.Time  `gorm:"index" json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+    Order           *Order     `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+}
+
+// 환불 상태
+const (
+    RefundStatusPending   = "pending"   // 환불 대기
+    RefundStatusCompleted = "completed" // 환불 완료
+)
+
+// 환불 발생 원인
+const (
+    RefundSourceOrderCancel = "order_cancel" // 결제 완료된 주문 취소 (매출 차감)
+    RefundSourceOverpaid    = "overpaid"     // 초과 입금
+    RefundSourceUnderpaid   = "underpaid"    // 부족 입금 등 결제 미완료 상태의 입금액
+    RefundSourceManual      = "manual"       // 직원 판단 (매출 차감)
+    RefundSourceSplitCancel = "split_cancel" // 분할 결제 도중 취소된 주문의 이미 받은 금액
+)
+
+// RefundReducesSales 매출에서 차감되는 환불인지 (초과/부족 입금은 매출이 아닌 입금액 반환)
+func RefundReducesSales(source string) bool {
+    return source == RefundSourceOrderCancel || source == RefundSourceManual
+}
+
+// DepositMovement 예수금 폴러가 관측한 예수금 변동 (대사 리포트의 기준)
+type DepositMovement struct {
+    ID                uint       `gorm:"primaryKey" json:"id"`
+    ObservedAt        time.Time  `gorm:"index" json:"observed_at"`
+    Provider          string     `json:"provider"`
+    Account           string     `gorm:"index" json:"account,omitempty"` // 입금 계좌 ID
+    PreviousBalance   int64      `json:"previous_balance"`
+    Balance           int64      `json:"balance"`
+    Delta             int64      `json:"delta"`
+    MatchedAmount     int64      `json:"matched_amount"`                // 결제에 할당된 금액
+    UnmatchedAmount   int64      `json:"unmatched_amount"`              // 어떤 결제에도 할당되지 않은 금액 (출금 포함)
+    MatchedPaymentIDs string     `json:"matched_payment_ids,omitempty"` // 할당된 결제 ID (쉼표로 구분, 직원 할당 포함)
+    Status            string     `gorm:"index" json:"status"`
+    ResolvedBy        string     `json:"resolved_by,omitempty"` // 할당/무시 처리한 직원
+    ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+    Note              string     `json:"note,omitempty"`
+    Source            string     `gorm:"index" json:"source,omitempty"` // 기록 출처 (비어 있으면 예수금 폴러, 기존 로그에서 가져온 변동은 legacy:파일:줄)
+    CreatedAt         time.Time  `json:"created_at"`
+}
+
+// 예수금 변동 상태
+const (
+    DepositMovementMatched   = "matched"   // 관측 시 결제에 모두 할당됨
+    DepositMovementUnmatched = "unmatched" // 결제에 할당되지 않은 금액이 남아 있음 (직원 확인 필요)
+    DepositMovementAssigned  = "assigned"  // 직원이 주문에 할당함
+    DepositMovementDismissed = "dismissed" // 결제와 무관한 변동으로 확인됨 (출금, 주식 매매 등)
+)
+
 // 요청 구조체
 // type CreateMenuRequest struct {
 //     CategoryID uint   `json:"category_id" binding:"required"`
@@ -59,7 +229,8 @@ type CreateMenuRequest struct {
 
 
 type CreateOrderRequest struct {
-    Items []OrderItemRequest `json:"items" binding:"required,min=1"`
+    Items     []OrderItemRequest `json:"items" binding:"required,min=1"`
+    RequestID string             `json:"request_id"` // 중복 요청 방지 키 (Idempotency-Key 헤더가 우선)
 }
 
 type OrderItemRequest struct {
@@ -67,8 +238,11 @@ type OrderItemRequest struct {
     Quantity int  `json:"quantity" binding:"required,min=1"`
 }
 
+// PaymentRequest 결제 요청 - 금액은 서버가 주문의 TotalPrice(분할 결제면 남은 금액 이하의 요청 금액)로 결정
 type PaymentRequest struct {
-    Amount int64 `json:"amount" binding:"required"`
+    OrderID   uint   `json:"order_id" binding:"required"`
+    Amount    int64  `json:"amount"`     // 분할 결제 시 이번에 결제할 금액 (비어 있으면 남은 금액 전체)
+    RequestID string `json:"request_id"` // 중복 요청 방지 키 (같은 키로 다시 보내면 처음 시작된 결제를 돌려줌)
 }
 
 // PaymentResponse 결제 응답 구조체
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"kiosk/handlers"
+	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -11,7 +12,8 @@ func SetupRoutes(r *gin.Engine) {
     r.Use(cors.New(cors.Config{
         AllowAllOrigins:  true,
         AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-        AllowHeaders:     []string{"Origin", "Content-Type"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Admin-Token", handlers.IdempotencyKeyHeader},
+        ExposeHeaders:    []string{handlers.IdempotentReplayedHeader},
     }))
     api := r.Group("/api")
     {
@@ -33,6 +35,7 @@ func SetupRoutes(r *gin.Engine) {
         // 주문 관련
         api.GET("/orders", handlers.GetOrders)
         api.GET("/orders/:id", handlers.GetOrder)
+        api.GET("/orders/:id/payments", handlers.GetOrderPayments)
         api.POST("/orders", handlers.CreateOrder)
         api.DELETE("/orders/:id", handlers.DeleteOrder)
         api.GET("/orders/period", handlers.GetOrdersByPeriod)
@@ -40,6 +43,57 @@ func SetupRoutes(r *gin.Engine) {
         // 결제 관련
         // api.POST("/payment", handlers.ProcessPayment)
         api.GET("/ws/payment", handlers.PaymentHandler)
+        api.GET("/payments", handlers.GetPayments)
+        api.POST("/payments", handlers.StartPayment)                // 웹소켓 없이 결제 시작
+        api.GET("/payments/:id", handlers.GetPayment)               // ?wait=30s&since=버전 이면 다음 상태 변화를 기다림
+        api.POST("/payments/:id/cancel", handlers.CancelPaymentSession)
+        api.GET("/payments/:id/qr", handlers.GetPaymentQR)
         api.GET("/orders/stream", handlers.OrdersEventStream)
+
+        // 리포트
+        api.GET("/reports/sales", handlers.GetSalesSummary)
+        api.GET("/reports/reconciliation", handlers.GetReconciliation)
+        api.GET("/reports/reconciliation/export", handlers.ExportReconciliation)
+
+        // 관리자 (ADMIN_TOKEN 인증)
+        admin := api.Group("/admin", handlers.AdminAuth(os.Getenv("ADMIN_TOKEN")))
+        {
+            // 결제 시뮬레이터 (PAYMENT_PROVIDER=simulator)
+            admin.GET("/simulator", handlers.GetSimulatorState)
+            admin.POST("/simulator/deposits", handlers.SimulatorDeposit)
+
+            // KIS API 환경 및 상태 (회로 차단기)
+            admin.GET("/kis/status", handlers.GetKISStatus)
+            admin.GET("/kis/health", handlers.GetKISHealth)
+
+            // 진행 중인 결제 조회 및 직원 강제 성공/실패 처리
+            admin.GET("/payments/active", handlers.GetActivePayments)
+            admin.POST("/payments/:id/override", handlers.OverridePayment)
+
+            // 입금 대기 정책 (조회 간격 곡선, 대기 시간, 유예 시간)
+            admin.GET("/payment-policy", handlers.GetPaymentPolicy)
+            admin.PUT("/payment-policy", handlers.UpdatePaymentPolicy)
+
+            // 카운터 결제 (현금 등 직원 확인 결제)
+            admin.POST("/orders/:id/confirm-payment", handlers.ConfirmCounterPayment)
+
+            // 주문 취소 및 환불
+            admin.POST("/orders/:id/cancel", handlers.CancelPaidOrder)
+            admin.GET("/refunds", handlers.GetRefunds)
+            admin.GET("/refunds/export", handlers.ExportRefunds)
+            admin.POST("/refunds", handlers.CreateRefund)
+            admin.GET("/refunds/:id", handlers.GetRefund)
+            admin.PUT("/refunds/:id", handlers.UpdateRefund)
+            admin.POST("/refunds/:id/complete", handlers.CompleteRefund)
+
+            // 결제에 할당되지 않은 예수금 변동 확인 및 주문 할당
+            admin.GET("/deposits", handlers.GetDepositMovements)
+            admin.GET("/deposits/accounts", handlers.GetDepositAccounts)
+            admin.POST("/deposits/:id/assign", handlers.AssignDepositMovement)
+            admin.POST("/deposits/:id/dismiss", handlers.DismissDepositMovement)
+
+            // 결제 감사 로그 검색
+            admin.GET("/payment-logs", handlers.GetPaymentLogs)
+        }
     }
 }
\ No newline at end of file
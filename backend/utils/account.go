@@ -3,9 +3,10 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -21,9 +22,14 @@ type KISApi struct {
 	AccountNo       string
 	AccountProdCode string
 	BaseURL         string
-	AccessToken     string
-	TokenExpireTime time.Time
 	ApprovalKey     string
+
+	config     KISConfig
+	tokens     *TokenManager
+	client     *http.Client
+	limiter    *RateLimiter
+	breaker    *CircuitBreaker
+	maxRetries int
 }
 
 // TokenRequest represents the token request payload
@@ -35,12 +41,15 @@ type TokenRequest struct {
 
 // TokenResponse represents the token response
 type TokenResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken        string `json:"access_token"`
+	AccessTokenExpired string `json:"access_token_token_expired"` // 만료 시각 (KST, "2006-01-02 15:04:05")
+	ExpiresIn          int64  `json:"expires_in"`                 // 유효 기간 (초)
 }
 
 // BalanceResponse represents the balance inquiry response
 type BalanceResponse struct {
 	RtCd    string           `json:"rt_cd"`
+	MsgCd   string           `json:"msg_cd"`
 	Msg1    string           `json:"msg1"`
 	Output1 []BalanceItem    `json:"output1"` // 개별 종목 정보 (현재 사용하지 않지만 API 응답 구조상 포함)
 	Output2 []BalanceSummary `json:"output2"`
@@ -57,29 +66,64 @@ type BalanceSummary struct {
 }
 
 type DepositState struct {
+	account        string // 입금 계좌 ID (예수금 변동 이벤트에 기록)
 	mu             sync.RWMutex
 	currentDeposit int64
 	lastUpdateTime time.Time
-	kisClient      *KISApi
+	lastPollError  error
+	fetchSeq       uint64        // 시작한 예수금 조회 순번
+	appliedSeq     uint64        // 마지막으로 반영한 예수금 조회 순번 (늦게 끝난 이전 조회 결과는 버림)
+	source         BalanceSource // 예수금 조회 대상 (KIS 계좌 또는 시뮬레이터)
+	matcher        *PaymentMatcher
+	pollInterval   time.Duration
+	pollSchedule   func(elapsed time.Duration) time.Duration // 결제 경과 시간별 조회 간격 (nil이면 pollInterval)
+
+	subMu       sync.Mutex
+	waiters     map[string]chan PaymentMatch // 결제별 입금 확인 채널
+	subscribers map[chan DepositEvent]bool   // 예수금 변동 구독자
+	wake        chan struct{}                // 대기 결제 등록 시 폴러를 깨우는 신호
 }
 
 // NewKISApi creates a new KIS API client
 func NewKISApi(appKey, appSecret, accountNo string, accountProdCode ...string) *KISApi {
-	prodCode := "01"
-	if len(accountProdCode) > 0 {
-		prodCode = accountProdCode[0]
+	config := DefaultKISConfig(KISEnvReal) // 실전투자
+	config.AppKey = appKey
+	config.AppSecret = appSecret
+	config.AccountNo = accountNo
+	if len(accountProdCode) > 0 && accountProdCode[0] != "" {
+		config.AccountProdCode = accountProdCode[0]
 	}
-	return &KISApi{
+	k := &KISApi{
 		AppKey:          appKey,
 		AppSecret:       appSecret,
 		AccountNo:       accountNo,
-		AccountProdCode: prodCode,
-		BaseURL:         "https://openapi.koreainvestment.com:9443", // 실전투자 URL
+		AccountProdCode: config.AccountProdCode,
+		BaseURL:         config.BaseURL,
+		config:          config,
+		client:          &http.Client{Timeout: DefaultKISTimeout},
+		limiter:         NewRateLimiter(DefaultKISRateLimit, 1),
+		breaker:         NewCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerOpenTimeout),
+		maxRetries:      DefaultKISMaxRetries,
 	}
+	k.tokens = NewTokenManager(k.issueToken, appKey)
+	return k
+}
+
+// Tokens 접근 토큰 관리자
+func (k *KISApi) Tokens() *TokenManager {
+	return k.tokens
 }
 
-// GetAccessToken obtains an OAuth token
+// GetAccessToken 유효한 접근 토큰을 확보합니다 (저장된 토큰이 유효하면 재발급하지 않음)
 func (k *KISApi) GetAccessToken() (bool, error) {
+	if _, err := k.tokens.Token(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// issueToken obtains a new OAuth token
+func (k *KISApi) issueToken() (string, time.Time, error) {
 	url := fmt.Sprintf("%s/oauth2/tokenP", k.BaseURL)
 	tokenRequest := TokenRequest{
 		GrantType: "client_credentials",
@@ -89,47 +133,54 @@ func (k *KISApi) GetAccessToken() (bool, error) {
 
 	jsonData, err := json.Marshal(tokenRequest)
 	if err != nil {
-		return false, fmt.Errorf("토큰 요청 데이터 마샬링 실패: %v", err)
+		return "", time.Time{}, fmt.Errorf("토큰 요청 데이터 마샬링 실패: %v", err)
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return false, fmt.Errorf("토큰 요청 생성 실패: %v", err)
+		return "", time.Time{}, fmt.Errorf("토큰 요청 생성 실패: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := k.client.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("토큰 요청 실패: %v", err)
+		return "", time.Time{}, fmt.Errorf("토큰 요청 실패: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
 		var tokenResp TokenResponse
 		if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-			return false, fmt.Errorf("토큰 응답 디코딩 실패: %v", err)
+			return "", time.Time{}, fmt.Errorf("토큰 응답 디코딩 실패: %v", err)
+		}
+		if tokenResp.AccessToken == "" {
+			return "", time.Time{}, fmt.Errorf("토큰 응답에 access_token이 없습니다")
 		}
-		k.AccessToken = tokenResp.AccessToken
-		// 토큰 만료 시간 설정 (현재 시간 + 23시간)
-		k.TokenExpireTime = time.Now().Add(23 * time.Hour)
-		fmt.Printf("토큰 발급 성공: %s...\n", k.AccessToken[:10])
-		return true, nil
+		expiresAt := tokenResp.expiresAt(time.Now())
+		fmt.Printf("토큰 발급 성공: %.10s... (만료: %s)\n", tokenResp.AccessToken, expiresAt.Local().Format("2006-01-02 15:04:05"))
+		return tokenResp.AccessToken, expiresAt, nil
 	}
 
-	return false, fmt.Errorf("토큰 발급 실패: %d", resp.StatusCode)
+	return "", time.Time{}, fmt.Errorf("토큰 발급 실패: %d", resp.StatusCode)
 }
 
-// GetBalance retrieves stock balance information
-func (k *KISApi) GetBalance() (*BalanceResponse, error) {
-	// Check token validity
-	if k.AccessToken == "" || time.Now().After(k.TokenExpireTime) {
-		success, err := k.GetAccessToken()
-		if !success || err != nil {
-			return nil, fmt.Errorf("토큰 갱신 실패: %v", err)
+// expiresAt 토큰 응답의 실제 만료 시각 (expires_in 우선, 없으면 만료 일시, 둘 다 없으면 23시간)
+func (t TokenResponse) expiresAt(issuedAt time.Time) time.Time {
+	if t.ExpiresIn > 0 {
+		return issuedAt.Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	if t.AccessTokenExpired != "" {
+		if kst, err := time.LoadLocation("Asia/Seoul"); err == nil {
+			if expiresAt, err := time.ParseInLocation("2006-01-02 15:04:05", t.AccessTokenExpired, kst); err == nil {
+				return expiresAt
+			}
 		}
 	}
+	return issuedAt.Add(23 * time.Hour)
+}
 
+// GetBalance retrieves stock balance information
+func (k *KISApi) GetBalance() (*BalanceResponse, error) {
 	baseURL := fmt.Sprintf("%s/uapi/domestic-stock/v1/trading/inquire-balance", k.BaseURL)
 	
 	// Create query parameters
@@ -147,44 +198,27 @@ func (k *KISApi) GetBalance() (*BalanceResponse, error) {
 	params.Add("CTX_AREA_NK100", "")
 
 	fullURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-	
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("잔고 조회 요청 생성 실패: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("authorization", fmt.Sprintf("Bearer %s", k.AccessToken))
-	req.Header.Set("appkey", k.AppKey)
-	req.Header.Set("appsecret", k.AppSecret)
-	req.Header.Set("tr_id", "TTTC8434R")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("잔고 조회 요청 실패: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("응답 읽기 실패: %v", err)
-	}
-
-	if resp.StatusCode == http.StatusOK {
-		var balanceResp BalanceResponse
-		if err := json.Unmarshal(body, &balanceResp); err != nil {
-			return nil, fmt.Errorf("잔고 응답 디코딩 실패: %v", err)
-		}
-
-		if balanceResp.RtCd == "0" {
-			return &balanceResp, nil
+	// 속도 제한, 재시도, 토큰 만료 처리, 회로 차단은 call에서 처리
+	var balanceResp BalanceResponse
+	err := k.call(context.Background(), "잔고 조회", func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("GET", fullURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("잔고 조회 요청 생성 실패: %v", err)
 		}
 
-		return nil, fmt.Errorf("잔고 조회 실패: %s", balanceResp.Msg1)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("appkey", k.AppKey)
+		req.Header.Set("appsecret", k.AppSecret)
+		req.Header.Set("tr_id", k.config.TrIDs.Balance)
+		return req, nil
+	}, &balanceResp)
+	if err != nil {
+		return nil, fmt.Errorf("잔고 조회 실패: %w", err)
 	}
 
-	return nil, fmt.Errorf("잔고 조회 실패: %d", resp.StatusCode)
+	return &balanceResp, nil
 }
 
 // GetDepositAmount retrieves only the deposit amount (예수금 총액)
@@ -226,12 +260,25 @@ func FormatNumber(n int64) string {
 // 여기서부터 main.go에서 옮긴 코드 시작
 
 // DepositState 예수금 상태를 관리하는 구조체
+// 예수금 조회는 Start로 실행되는 하나의 폴러만 수행하며, 결제 세션은 폴러가 보내는 이벤트를 기다립니다.
 
+// DefaultDepositPollInterval 기본 예수금 조회 간격
+const DefaultDepositPollInterval = 1 * time.Second
+
+// BalanceSource 예수금 총액을 조회할 수 있는 대상
+type BalanceSource interface {
+	GetDepositAmount() (int64, error)
+}
 
 // NewDepositState 새로운 DepositState 인스턴스 생성
-func NewDepositState(kisClient *KISApi) *DepositState {
+func NewDepositState(source BalanceSource) *DepositState {
 	return &DepositState{
-		kisClient: kisClient,
+		source:       source,
+		matcher:      NewPaymentMatcher(0),
+		pollInterval: DefaultDepositPollInterval,
+		waiters:      make(map[string]chan PaymentMatch),
+		subscribers:  make(map[chan DepositEvent]bool),
+		wake:         make(chan struct{}, 1),
 	}
 }
 
@@ -240,7 +287,7 @@ func (ds *DepositState) Initialize() error {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	depositAmount, err := ds.kisClient.GetDepositAmount()
+	depositAmount, err := ds.source.GetDepositAmount()
 	if err != nil {
 		return err
 	}
@@ -258,30 +305,212 @@ func (ds *DepositState) GetCurrentDeposit() int64 {
 	return ds.currentDeposit
 }
 
-// UpdateAndCheckDeposit 예수금 업데이트 및 변동 확인
-func (ds *DepositState) UpdateAndCheckDeposit(expectedAmount int64) (bool, int64, error) {
+// SourceHealth 예수금 조회 대상의 상태 (회로 차단기를 지원하지 않는 대상이면 ok=false)
+func (ds *DepositState) SourceHealth() (health SourceHealth, ok bool) {
+	reporter, ok := ds.source.(HealthReporter)
+	if !ok {
+		return SourceHealth{}, false
+	}
+	return reporter.Health(), true
+}
+
+// LastPollError 마지막 예수금 조회 오류 (성공했으면 nil)
+func (ds *DepositState) LastPollError() error {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.lastPollError
+}
+
+// SetMaxAmountOffset 동시 결제 금액을 구분하기 위한 원 단위 오프셋 최대값 설정 (0이면 사용 안 함)
+func (ds *DepositState) SetMaxAmountOffset(maxOffset int64) {
+	ds.matcher.SetMaxOffset(maxOffset)
+}
+
+// SetMatchTolerance 금액이 다른 입금을 하나뿐인 대기 결제에 할당할 때 허용하는 차이 설정 (%, 0이면 할당 안 함)
+func (ds *DepositState) SetMatchTolerance(percent int64) {
+	ds.matcher.SetTolerance(percent)
+}
+
+// SetPollInterval 예수금 조회 간격 설정 (KIS 호출 빈도 = 1 / interval)
+func (ds *DepositState) SetPollInterval(interval time.Duration) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
+	if interval > 0 {
+		ds.pollInterval = interval
+	}
+}
+
+// SetPollSchedule 결제 경과 시간별 예수금 조회 간격 설정
+// 대기 중인 결제가 여러 개이면 그중 가장 짧은 간격으로 조회합니다.
+func (ds *DepositState) SetPollSchedule(schedule func(elapsed time.Duration) time.Duration) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.pollSchedule = schedule
+}
+
+// nextPollIntervalLocked 다음 예수금 조회까지의 간격 (ds.mu 잠금 상태에서 호출)
+func (ds *DepositState) nextPollIntervalLocked() time.Duration {
+	if ds.pollSchedule == nil {
+		return ds.pollInterval
+	}
+	var interval time.Duration
+	now := time.Now()
+	for _, pending := range ds.matcher.Pending() {
+		if next := ds.pollSchedule(now.Sub(pending.RegisteredAt)); interval == 0 || next < interval {
+			interval = next
+		}
+	}
+	if interval <= 0 {
+		return ds.pollInterval
+	}
+	return interval
+}
+
+// RegisterPayment 입금 대기 결제를 등록하고 고객이 입금해야 할 금액과 입금 확인 채널을 반환
+// 등록 전에 예수금을 다시 조회하여, 그 사이의 변동은 이미 대기 중인 결제에만 할당되도록 합니다.
+// KIS 회로 차단 중이면 마지막으로 확인한 예수금을 기준으로 등록합니다 (복구 후 폴러가 변동을 할당).
+func (ds *DepositState) RegisterPayment(paymentID string, baseAmount int64) (amount int64, baseline int64, confirmed <-chan PaymentMatch, err error) {
+	if err := ds.refreshForRegistration(paymentID); err != nil {
+		return 0, 0, nil, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if amount, err = ds.matcher.Register(paymentID, baseAmount); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return amount, ds.currentDeposit, ds.addWaiterLocked(paymentID), nil
+}
+
+// ResumePayment 서버 재시작 전에 시작된 결제를 같은 금액으로 다시 입금 대기 등록합니다
+func (ds *DepositState) ResumePayment(paymentID string, amount int64) (baseline int64, confirmed <-chan PaymentMatch, err error) {
+	if err := ds.refreshForRegistration(paymentID); err != nil {
+		return 0, nil, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if err := ds.matcher.RegisterExact(paymentID, amount); err != nil {
+		return 0, nil, err
+	}
+
+	return ds.currentDeposit, ds.addWaiterLocked(paymentID), nil
+}
+
+// refreshForRegistration 결제 등록 전 예수금 조회 (회로 차단 중이면 마지막 예수금으로 진행)
+func (ds *DepositState) refreshForRegistration(paymentID string) error {
+	err := ds.refresh()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		log.Printf("[주의] KIS 회로 차단 중 - 마지막 예수금(%s원) 기준으로 결제 등록, 결제 ID: %s",
+			FormatNumber(ds.GetCurrentDeposit()), paymentID)
+		return nil
+	}
+	return fmt.Errorf("초기 예수금 조회 오류: %v", err)
+}
+
+// addWaiterLocked 결제별 입금 확인 채널을 만들고 폴러를 깨웁니다 (ds.mu 잠금 상태에서 호출)
+func (ds *DepositState) addWaiterLocked(paymentID string) <-chan PaymentMatch {
+	confirmed := make(chan PaymentMatch, 8)
+	ds.subMu.Lock()
+	ds.waiters[paymentID] = confirmed
+	ds.subMu.Unlock()
+
+	// 대기 중이던 폴러 깨우기
+	select {
+	case ds.wake <- struct{}{}:
+	default:
+	}
+
+	return confirmed
+}
+
+// UnregisterPayment 입금 대기 결제 등록 해제
+// 할당과 전달(refresh)이 끝날 때까지 기다리므로, 반환 후에는 확인 채널에 남은 입금 외에 새로 할당되는 입금이 없습니다.
+func (ds *DepositState) UnregisterPayment(paymentID string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.matcher.Unregister(paymentID)
+
+	ds.subMu.Lock()
+	defer ds.subMu.Unlock()
+	delete(ds.waiters, paymentID)
+}
+
+// IsPending 결제가 입금 대기 중인지 확인
+func (ds *DepositState) IsPending(paymentID string) bool {
+	return ds.matcher.Has(paymentID)
+}
+
+// PendingPayments 입금 대기 중인 결제 목록
+func (ds *DepositState) PendingPayments() []PendingPayment {
+	return ds.matcher.Pending()
+}
+
+// refresh 최신 예수금을 조회하고 변동액을 대기 중인 결제에 할당합니다.
+// 조회(재시도, 대기 포함)는 ds.mu 밖에서 하므로 장애 중에도 상태 조회와 결제 등록이 막히지 않습니다.
+func (ds *DepositState) refresh() error {
+	ds.mu.Lock()
+	ds.fetchSeq++
+	seq := ds.fetchSeq
+	ds.mu.Unlock()
 
 	// 최신 예수금 조회
-	newDepositAmount, err := ds.kisClient.GetDepositAmount()
+	newDepositAmount, err := ds.source.GetDepositAmount()
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if seq < ds.appliedSeq {
+		// 나중에 시작된 조회가 이미 반영됨
+		return err
+	}
+	ds.appliedSeq = seq
+	ds.lastPollError = err
 	if err != nil {
-		return false, 0, err
+		return err
 	}
 
 	// 실제 변동액 계산
-	actualChange := newDepositAmount - ds.currentDeposit
+	previousDeposit := ds.currentDeposit
+	actualChange := newDepositAmount - previousDeposit
 
 	// 상태 업데이트
 	ds.currentDeposit = newDepositAmount
 	ds.lastUpdateTime = time.Now()
 
-	// 예상 변동액과 실제 변동액 비교
-	return actualChange == expectedAmount, actualChange, nil
+	if actualChange == 0 {
+		return nil
+	}
+
+	// 변동액을 대기 중인 결제에 할당
+	matches, remainder := ds.matcher.Match(actualChange)
+	for _, match := range matches {
+		log.Printf("예수금 변동 할당 - 결제 ID: %s, 금액: %s원", match.PaymentID, FormatNumber(match.Amount))
+	}
+	if remainder != 0 {
+		log.Printf("[주의] 결제에 할당되지 않은 예수금 변동: %s원 (현재 예수금: %s원)",
+			FormatNumber(remainder), FormatNumber(newDepositAmount))
+	}
+
+	ds.publish(DepositEvent{
+		PreviousDeposit: previousDeposit,
+		CurrentDeposit:  newDepositAmount,
+		Delta:           actualChange,
+		Matches:         matches,
+		Unmatched:       remainder,
+		ObservedAt:      ds.lastUpdateTime,
+		Account:         ds.account,
+	})
+	return nil
 }
 
 func (ds *DepositState) GetKISDepositAmount() (int64, error) {
-	return ds.kisClient.GetDepositAmount()
+	return ds.source.GetDepositAmount()
 }
 
 // SetCurrentDeposit 예수금 수동 설정 (강제 업데이트)
@@ -290,4 +519,4 @@ func (ds *DepositState) SetCurrentDeposit(amount int64) {
 	defer ds.mu.Unlock()
 	ds.currentDeposit = amount
 	ds.lastUpdateTime = time.Now()
-}
\ No newline at end of file
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// DepositEvent 폴러가 관측한 예수금 변동
+type DepositEvent struct {
+	PreviousDeposit int64          `json:"previous_deposit"`
+	CurrentDeposit  int64          `json:"current_deposit"`
+	Delta           int64          `json:"delta"`
+	Matches         []PaymentMatch `json:"matches,omitempty"` // 결제에 할당된 금액
+	Unmatched       int64          `json:"unmatched"`         // 어떤 결제에도 할당되지 않은 금액
+	ObservedAt      time.Time      `json:"observed_at"`
+	Account         string         `json:"account,omitempty"` // 입금 계좌 ID
+}
+
+// Start 예수금 폴러 시작
+// 입금 대기 중인 결제가 있을 때만 KIS 잔고를 조회하며, 조회 간격은 결제 경과 시간별 간격(SetPollSchedule) 또는 pollInterval입니다.
+func (ds *DepositState) Start(ctx context.Context) {
+	go ds.pollLoop(ctx)
+}
+
+func (ds *DepositState) pollLoop(ctx context.Context) {
+	consecutiveErrors := 0
+
+	for {
+		// 대기 중인 결제가 없으면 등록될 때까지 대기
+		if ds.matcher.PendingCount() == 0 {
+			select {
+			case <-ds.wake:
+				continue
+			case <-ctx.Done():
+				log.Println("예수금 폴러 종료")
+				return
+			}
+		}
+
+		err := ds.refresh()
+		ds.mu.RLock()
+		interval := ds.nextPollIntervalLocked()
+		ds.mu.RUnlock()
+
+		if err != nil {
+			consecutiveErrors++
+			if !errors.Is(err, ErrCircuitOpen) {
+				log.Printf("예수금 조회 실패 (%d회 연속): %v", consecutiveErrors, err)
+			}
+			// 연속 실패 시 조회 간격을 늘려 KIS 호출을 줄임 (최대 8배)
+			backoff := consecutiveErrors
+			if backoff > 8 {
+				backoff = 8
+			}
+			interval *= time.Duration(backoff)
+		} else {
+			consecutiveErrors = 0
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			log.Println("예수금 폴러 종료")
+			return
+		}
+	}
+}
+
+// Subscribe 예수금 변동 이벤트 구독
+// 반환된 함수를 호출하면 구독이 해제됩니다.
+func (ds *DepositState) Subscribe() (<-chan DepositEvent, func()) {
+	ch := make(chan DepositEvent, 16)
+
+	ds.subMu.Lock()
+	ds.subscribers[ch] = true
+	ds.subMu.Unlock()
+
+	unsubscribe := func() {
+		ds.subMu.Lock()
+		defer ds.subMu.Unlock()
+		if ds.subscribers[ch] {
+			delete(ds.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// subscriberSendTimeout 구독자의 버퍼가 가득 찼을 때 이벤트를 버리기 전까지 기다리는 시간
+// (예수금 변동 기록이 빠지면 대사 리포트에 잔액 불일치로 나타남)
+const subscriberSendTimeout = 2 * time.Second
+
+// publish 결제별 확인 채널과 구독자에게 이벤트 전달
+// 구독자의 버퍼가 가득 차면 subscriberSendTimeout까지 기다린 뒤 버리고 오류를 기록합니다.
+func (ds *DepositState) publish(event DepositEvent) {
+	ds.subMu.Lock()
+	defer ds.subMu.Unlock()
+
+	for _, match := range event.Matches {
+		if waiter, ok := ds.waiters[match.PaymentID]; ok {
+			select {
+			case waiter <- match:
+			default:
+				log.Printf("결제 입금 확인 채널이 가득 찼습니다 - ID: %s", match.PaymentID)
+			}
+			// 부족 입금이면 추가 입금을 위해 채널 유지
+			if match.Complete() {
+				delete(ds.waiters, match.PaymentID)
+			}
+		}
+	}
+
+	for ch := range ds.subscribers {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+
+		timer := time.NewTimer(subscriberSendTimeout)
+		select {
+		case ch <- event:
+		case <-timer.C:
+			log.Printf("[중요] 예수금 이벤트 구독자가 %v 동안 이벤트를 받지 않아 버림 - 계좌: %s, 변동: %s원, 할당되지 않은 금액: %s원, 관측 시각: %s",
+				subscriberSendTimeout, event.Account, FormatNumber(event.Delta), FormatNumber(event.Unmatched), event.ObservedAt.Format(time.RFC3339))
+		}
+		timer.Stop()
+	}
+}
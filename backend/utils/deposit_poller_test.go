@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishWaitsForSlowSubscriber(t *testing.T) {
+	ds := NewDepositState(nil)
+	events, unsubscribe := ds.Subscribe()
+	defer unsubscribe()
+
+	// 구독자가 잠시 이벤트를 읽지 않는 동안 버퍼보다 많은 변동이 관측됨
+	const total = 20
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= total; i++ {
+			ds.publish(DepositEvent{Delta: int64(i)})
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	for i := 1; i <= total; i++ {
+		select {
+		case event := <-events:
+			if event.Delta != int64(i) {
+				t.Fatalf("%d번째 이벤트 변동 = %d, want %d", i, event.Delta, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d번째 이벤트를 받지 못함", i)
+		}
+	}
+	<-done
+}
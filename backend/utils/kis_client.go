@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KIS 클라이언트 기본 설정
+const (
+	DefaultKISTimeout    = 10 * time.Second
+	DefaultKISRateLimit  = 10 // 초당 요청 수 (실전투자 계좌 한도보다 낮게)
+	DefaultKISMaxRetries = 3
+
+	kisRetryBaseDelay = 200 * time.Millisecond
+	kisRetryMaxDelay  = 3 * time.Second
+
+	DefaultBreakerThreshold   = 5                // 연속 실패 시 회로 차단
+	DefaultBreakerOpenTimeout = 30 * time.Second // 차단 후 재시도까지 대기
+)
+
+// KIS 응답 메시지 코드
+const (
+	kisMsgCdTokenExpired = "EGW00123" // 기간이 만료된 token
+	kisMsgCdTokenInvalid = "EGW00121" // 유효하지 않은 token
+	kisMsgCdRateLimited  = "EGW00201" // 초당 거래건수 초과
+)
+
+// ErrCircuitOpen 회로 차단기가 열려 KIS 호출을 하지 않음
+var ErrCircuitOpen = errors.New("KIS API 회로 차단 중")
+
+// KISError KIS API 오류 응답
+type KISError struct {
+	StatusCode int
+	RtCd       string
+	MsgCd      string
+	Msg1       string
+}
+
+func (e *KISError) Error() string {
+	if e.Msg1 != "" {
+		return fmt.Sprintf("KIS 오류 (HTTP %d, %s): %s", e.StatusCode, e.MsgCd, e.Msg1)
+	}
+	return fmt.Sprintf("KIS 오류 (HTTP %d)", e.StatusCode)
+}
+
+// tokenExpired 토큰 만료/무효 응답인지
+func (e *KISError) tokenExpired() bool {
+	return e.MsgCd == kisMsgCdTokenExpired || e.MsgCd == kisMsgCdTokenInvalid
+}
+
+// transient 잠시 후 다시 시도하면 성공할 수 있는 오류인지
+func (e *KISError) transient() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.MsgCd == kisMsgCdRateLimited
+}
+
+// kisEnvelope 모든 KIS 응답에 공통으로 포함되는 필드
+type kisEnvelope struct {
+	RtCd  string `json:"rt_cd"`
+	MsgCd string `json:"msg_cd"`
+	Msg1  string `json:"msg1"`
+}
+
+// RateLimiter 토큰 버킷 방식의 요청 속도 제한
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // 초당 토큰
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+// NewRateLimiter 초당 rate개의 요청을 허용하는 RateLimiter 생성 (rate <= 0이면 제한 없음)
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), lastFill: time.Now()}
+}
+
+// Wait 요청을 보낼 수 있을 때까지 대기
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		rl.mu.Lock()
+		if rl.rate <= 0 {
+			rl.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		rl.tokens += now.Sub(rl.lastFill).Seconds() * rl.rate
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+		rl.lastFill = now
+		if rl.tokens >= 1 {
+			rl.tokens--
+			rl.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - rl.tokens) / rl.rate * float64(time.Second))
+		rl.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// 회로 차단기 상태
+const (
+	CircuitClosed   = "closed"    // 정상
+	CircuitOpen     = "open"      // 연속 실패로 호출 차단
+	CircuitHalfOpen = "half_open" // 차단 시간이 지나 시험 호출 중
+)
+
+// SourceHealth 예수금 조회 대상의 상태
+type SourceHealth struct {
+	Circuit             string     `json:"circuit"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// Degraded 정상 상태가 아닌지
+func (h SourceHealth) Degraded() bool {
+	return h.Circuit != CircuitClosed
+}
+
+// HealthReporter 상태를 보고할 수 있는 예수금 조회 대상
+type HealthReporter interface {
+	Health() SourceHealth
+}
+
+// CircuitBreaker 연속 실패 시 일정 시간 동안 호출을 차단합니다.
+// 차단 시간이 지나면 한 번의 시험 호출을 허용하고, 성공하면 정상 상태로 돌아갑니다.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	state       string
+	failures    int
+	threshold   int
+	openTimeout time.Duration
+	openedAt    time.Time
+	probing     bool
+	lastError   error
+	lastSuccess time.Time
+}
+
+// NewCircuitBreaker 새로운 CircuitBreaker 생성
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{state: CircuitClosed, threshold: threshold, openTimeout: openTimeout}
+}
+
+// Allow 호출해도 되는지 확인 (차단 중이면 ErrCircuitOpen)
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.openTimeout {
+			return ErrCircuitOpen
+		}
+		cb.state = CircuitHalfOpen
+		cb.probing = true
+		log.Println("KIS API 회로 차단기 반개방 - 시험 호출")
+		return nil
+	case CircuitHalfOpen:
+		// 시험 호출은 한 번에 하나만
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Success 호출 성공 기록
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != CircuitClosed {
+		log.Println("KIS API 회로 차단기 복구 - 정상 상태")
+	}
+	cb.state = CircuitClosed
+	cb.failures = 0
+	cb.probing = false
+	cb.lastError = nil
+	cb.lastSuccess = time.Now()
+}
+
+// Failure 호출 실패 기록
+func (cb *CircuitBreaker) Failure(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.lastError = err
+	cb.probing = false
+	if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.threshold) {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+		log.Printf("[주의] KIS API 회로 차단 (%d회 연속 실패, %v 후 재시도): %v", cb.failures, cb.openTimeout, err)
+	}
+}
+
+// Health 현재 상태
+func (cb *CircuitBreaker) Health() SourceHealth {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	health := SourceHealth{Circuit: cb.state, ConsecutiveFailures: cb.failures}
+	if cb.state != CircuitClosed {
+		openedAt := cb.openedAt
+		retryAt := cb.openedAt.Add(cb.openTimeout)
+		health.OpenedAt = &openedAt
+		health.RetryAt = &retryAt
+	}
+	if cb.lastError != nil {
+		health.LastError = cb.lastError.Error()
+	}
+	if !cb.lastSuccess.IsZero() {
+		lastSuccess := cb.lastSuccess
+		health.LastSuccessAt = &lastSuccess
+	}
+	return health
+}
+
+// SetKISClientOptions HTTP 타임아웃, 초당 요청 수, 재시도 횟수 설정
+func (k *KISApi) SetKISClientOptions(timeout time.Duration, ratePerSecond float64, maxRetries int) {
+	if timeout > 0 {
+		k.client = &http.Client{Timeout: timeout}
+	}
+	k.limiter = NewRateLimiter(ratePerSecond, 1)
+	if maxRetries >= 0 {
+		k.maxRetries = maxRetries
+	}
+}
+
+// Breaker 회로 차단기
+func (k *KISApi) Breaker() *CircuitBreaker {
+	return k.breaker
+}
+
+// Health 예수금 조회 대상 상태 (HealthReporter 구현)
+func (k *KISApi) Health() SourceHealth {
+	return k.breaker.Health()
+}
+
+// call 토큰이 필요한 KIS API를 호출합니다.
+// 속도 제한을 지키며, 일시적인 오류는 지터가 있는 지수 백오프로 재시도하고,
+// 토큰 만료 응답을 받으면 토큰을 재발급하여 한 번 더 시도합니다.
+// 연속으로 실패하면 회로 차단기가 열려 일정 시간 동안 즉시 ErrCircuitOpen을 반환합니다.
+func (k *KISApi) call(ctx context.Context, name string, build func(token string) (*http.Request, error), out interface{}) error {
+	tokenRetried := false
+	var lastErr error
+
+	for attempt := 0; attempt <= k.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retryDelay(attempt)
+			log.Printf("%s 재시도 %d/%d (%v 후): %v", name, attempt, k.maxRetries, delay, lastErr)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := k.breaker.Allow(); err != nil {
+			return err
+		}
+		if err := k.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		token, err := k.tokens.Token()
+		if err != nil {
+			lastErr = fmt.Errorf("토큰 갱신 실패: %v", err)
+			k.breaker.Failure(lastErr)
+			continue
+		}
+
+		req, err := build(token)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+
+		err = k.do(req, out)
+		if err == nil {
+			k.breaker.Success()
+			return nil
+		}
+		lastErr = err
+
+		var kisErr *KISError
+		if errors.As(err, &kisErr) {
+			if kisErr.tokenExpired() && !tokenRetried {
+				// 토큰 만료 - 재발급 후 바로 다시 시도 (재시도 횟수에 포함하지 않음)
+				log.Printf("%s: 토큰 만료 응답, 토큰 재발급 후 재시도", name)
+				k.tokens.Invalidate(token)
+				tokenRetried = true
+				attempt--
+				continue
+			}
+			if !kisErr.transient() {
+				// KIS에는 도달했으나 요청이 거부됨 - 재시도해도 같은 결과
+				k.breaker.Success()
+				return err
+			}
+		}
+
+		// 네트워크 오류, 5xx, 초당 거래건수 초과 등
+		k.breaker.Failure(err)
+	}
+	return lastErr
+}
+
+// do HTTP 요청을 보내고 응답을 out에 디코딩합니다. rt_cd가 "0"이 아니면 KISError를 반환합니다.
+func (k *KISApi) do(req *http.Request, out interface{}) error {
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("요청 실패: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("응답 읽기 실패: %v", err)
+	}
+
+	var envelope kisEnvelope
+	json.Unmarshal(body, &envelope)
+
+	if resp.StatusCode != http.StatusOK {
+		return &KISError{StatusCode: resp.StatusCode, RtCd: envelope.RtCd, MsgCd: envelope.MsgCd, Msg1: envelope.Msg1}
+	}
+	if envelope.RtCd != "0" {
+		return &KISError{StatusCode: resp.StatusCode, RtCd: envelope.RtCd, MsgCd: envelope.MsgCd, Msg1: envelope.Msg1}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("응답 디코딩 실패: %v", err)
+	}
+	return nil
+}
+
+// retryDelay 지터가 있는 지수 백오프 (attempt는 1부터)
+func retryDelay(attempt int) time.Duration {
+	delay := kisRetryBaseDelay << (attempt - 1)
+	if delay > kisRetryMaxDelay {
+		delay = kisRetryMaxDelay
+	}
+	// 50% ~ 150%
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
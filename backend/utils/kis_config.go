@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KIS 환경
+const (
+	KISEnvReal   = "real"   // 실전투자
+	KISEnvMock   = "mock"   // 모의투자 (openapivts)
+	KISEnvCustom = "custom" // 로컬 가짜 서버 등 (KIS_BASE_URL 필수)
+)
+
+// KIS 환경별 기본 주소
+const (
+	KISRealBaseURL = "https://openapi.koreainvestment.com:9443"
+	KISMockBaseURL = "https://openapivts.koreainvestment.com:29443"
+)
+
+// 모의투자는 초당 요청 한도가 낮음
+const DefaultKISMockRateLimit = 2
+
+// KISTrIDs 환경별 거래 ID
+type KISTrIDs struct {
+	Balance string `json:"balance"` // 주식 잔고 조회
+}
+
+var (
+	kisRealTrIDs = KISTrIDs{Balance: "TTTC8434R"}
+	kisMockTrIDs = KISTrIDs{Balance: "VTTC8434R"}
+
+	accountNoPattern   = regexp.MustCompile(`^\d{8}$`)
+	accountProdPattern = regexp.MustCompile(`^\d{2}$`)
+)
+
+// KISConfig KIS API 접속 설정
+type KISConfig struct {
+	Env             string
+	BaseURL         string
+	TrIDs           KISTrIDs
+	AppKey          string
+	AppSecret       string
+	AccountNo       string // 종합계좌번호 앞 8자리
+	AccountProdCode string // 계좌상품코드 뒤 2자리
+
+	Timeout    time.Duration
+	RateLimit  float64 // 초당 요청 수 (0이면 제한 없음)
+	MaxRetries int
+}
+
+// DefaultKISConfig 환경별 기본 설정 (env가 비어 있으면 실전투자)
+func DefaultKISConfig(env string) KISConfig {
+	if env == "" {
+		env = KISEnvReal
+	}
+	config := KISConfig{
+		Env:             env,
+		BaseURL:         KISRealBaseURL,
+		TrIDs:           kisRealTrIDs,
+		AccountProdCode: "01",
+		Timeout:         DefaultKISTimeout,
+		RateLimit:       DefaultKISRateLimit,
+		MaxRetries:      DefaultKISMaxRetries,
+	}
+	switch env {
+	case KISEnvMock:
+		config.BaseURL = KISMockBaseURL
+		config.TrIDs = kisMockTrIDs
+		config.RateLimit = DefaultKISMockRateLimit
+	case KISEnvCustom:
+		config.BaseURL = ""
+	}
+	return config
+}
+
+// LoadKISConfigFromEnv 환경 변수에서 KIS 설정을 읽고 검증합니다.
+//
+//	KIS_ENV                real(기본값) | mock | custom
+//	KIS_BASE_URL           API 주소 (custom이면 필수, 그 외에는 환경 기본 주소를 덮어씀)
+//	KIS_BALANCE_TR_ID      잔고 조회 tr_id (기본값: 실전 TTTC8434R, 모의 VTTC8434R)
+//	KIS_APP_KEY, KIS_APP_SECRET, KIS_ACCOUNT_NO, KIS_ACCOUNT_PROD_CODE
+//	KIS_HTTP_TIMEOUT, KIS_RATE_LIMIT, KIS_MAX_RETRIES
+func LoadKISConfigFromEnv() (KISConfig, error) {
+	config := DefaultKISConfig(strings.ToLower(strings.TrimSpace(os.Getenv("KIS_ENV"))))
+
+	if value := os.Getenv("KIS_BASE_URL"); value != "" {
+		config.BaseURL = strings.TrimRight(value, "/")
+	}
+	if value := os.Getenv("KIS_BALANCE_TR_ID"); value != "" {
+		config.TrIDs.Balance = value
+	}
+
+	config.AppKey = os.Getenv("KIS_APP_KEY")
+	config.AppSecret = os.Getenv("KIS_APP_SECRET")
+	config.AccountNo = os.Getenv("KIS_ACCOUNT_NO")
+	if value := os.Getenv("KIS_ACCOUNT_PROD_CODE"); value != "" {
+		config.AccountProdCode = value
+	}
+
+	if value := os.Getenv("KIS_HTTP_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("KIS_HTTP_TIMEOUT 값이 올바르지 않습니다: %s", value)
+		}
+		config.Timeout = timeout
+	}
+	if value := os.Getenv("KIS_RATE_LIMIT"); value != "" {
+		rateLimit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, fmt.Errorf("KIS_RATE_LIMIT 값이 올바르지 않습니다: %s", value)
+		}
+		config.RateLimit = rateLimit
+	}
+	if value := os.Getenv("KIS_MAX_RETRIES"); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("KIS_MAX_RETRIES 값이 올바르지 않습니다: %s", value)
+		}
+		config.MaxRetries = maxRetries
+	}
+
+	return config, config.Validate()
+}
+
+// LoadKISAccountConfigsFromEnv 입금 계좌별 KIS 설정을 읽고 검증합니다 (첫 번째가 기본 계좌).
+// 기본 계좌는 LoadKISConfigFromEnv와 같고, 추가 계좌는 2부터 번호를 붙여 인증 정보와 계좌번호만 따로 지정합니다.
+// 환경, 주소, tr_id, 클라이언트 옵션은 기본 계좌와 같습니다.
+//
+//	KIS_APP_KEY_2, KIS_APP_SECRET_2, KIS_ACCOUNT_NO_2, KIS_ACCOUNT_PROD_CODE_2
+//	KIS_APP_KEY_3, ...
+func LoadKISAccountConfigsFromEnv() ([]KISConfig, error) {
+	primary, err := LoadKISConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	configs := []KISConfig{primary}
+
+	for n := 2; ; n++ {
+		accountNo := os.Getenv(fmt.Sprintf("KIS_ACCOUNT_NO_%d", n))
+		if accountNo == "" {
+			break
+		}
+		config := primary
+		config.AppKey = os.Getenv(fmt.Sprintf("KIS_APP_KEY_%d", n))
+		config.AppSecret = os.Getenv(fmt.Sprintf("KIS_APP_SECRET_%d", n))
+		config.AccountNo = accountNo
+		config.AccountProdCode = DefaultKISConfig(primary.Env).AccountProdCode
+		if value := os.Getenv(fmt.Sprintf("KIS_ACCOUNT_PROD_CODE_%d", n)); value != "" {
+			config.AccountProdCode = value
+		}
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("%d번 계좌: %v", n, err)
+		}
+		for _, existing := range configs {
+			if existing.AccountID() == config.AccountID() {
+				return nil, fmt.Errorf("%d번 계좌가 이미 설정된 계좌와 같습니다: %s", n, config.MaskedAccount())
+			}
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// Validate 설정 검증
+func (c KISConfig) Validate() error {
+	switch c.Env {
+	case KISEnvReal, KISEnvMock, KISEnvCustom:
+	default:
+		return fmt.Errorf("알 수 없는 KIS_ENV: %s (real, mock 또는 custom)", c.Env)
+	}
+
+	if c.AppKey == "" || c.AppSecret == "" || c.AccountNo == "" {
+		return fmt.Errorf("KIS API 인증 정보가 설정되지 않았습니다 (KIS_APP_KEY, KIS_APP_SECRET, KIS_ACCOUNT_NO)")
+	}
+	if !accountNoPattern.MatchString(c.AccountNo) {
+		return fmt.Errorf("KIS_ACCOUNT_NO는 계좌번호 앞 8자리 숫자여야 합니다")
+	}
+	if !accountProdPattern.MatchString(c.AccountProdCode) {
+		return fmt.Errorf("KIS_ACCOUNT_PROD_CODE는 2자리 숫자여야 합니다: %s", c.AccountProdCode)
+	}
+
+	if c.BaseURL == "" {
+		return fmt.Errorf("KIS_ENV=%s에는 KIS_BASE_URL이 필요합니다", c.Env)
+	}
+	parsed, err := url.Parse(c.BaseURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("KIS_BASE_URL이 올바르지 않습니다: %s", c.BaseURL)
+	}
+
+	if c.TrIDs.Balance == "" {
+		return fmt.Errorf("잔고 조회 tr_id가 비어 있습니다")
+	}
+	// 실전/모의 tr_id를 섞어 쓰면 KIS가 거부하므로 시작 시 막음
+	switch {
+	case c.Env == KISEnvReal && !strings.HasPrefix(c.TrIDs.Balance, "T"):
+		return fmt.Errorf("실전투자 환경에 모의투자 tr_id를 사용할 수 없습니다: %s", c.TrIDs.Balance)
+	case c.Env == KISEnvMock && !strings.HasPrefix(c.TrIDs.Balance, "V"):
+		return fmt.Errorf("모의투자 환경에 실전투자 tr_id를 사용할 수 없습니다: %s", c.TrIDs.Balance)
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("KIS_HTTP_TIMEOUT은 0보다 커야 합니다")
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("KIS_RATE_LIMIT은 0 이상이어야 합니다")
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("KIS_MAX_RETRIES는 0 이상이어야 합니다")
+	}
+	return nil
+}
+
+// MaskedAccount 화면/로그용 계좌번호 (앞 4자리만 표시)
+func (c KISConfig) MaskedAccount() string {
+	if len(c.AccountNo) <= 4 {
+		return c.AccountNo + "-" + c.AccountProdCode
+	}
+	return c.AccountNo[:4] + strings.Repeat("*", len(c.AccountNo)-4) + "-" + c.AccountProdCode
+}
+
+// AccountID 입금 계좌 ID (계좌번호-상품코드)
+func (c KISConfig) AccountID() string {
+	return c.AccountNo + "-" + c.AccountProdCode
+}
+
+// KISStatus 현재 사용 중인 KIS 환경 정보 (비밀 값 제외)
+type KISStatus struct {
+	Env            string       `json:"env"`
+	BaseURL        string       `json:"base_url"`
+	TrIDs          KISTrIDs     `json:"tr_ids"`
+	Account        string       `json:"account"`
+	Timeout        string       `json:"timeout"`
+	RateLimit      float64      `json:"rate_limit"`
+	MaxRetries     int          `json:"max_retries"`
+	TokenExpiresAt *time.Time   `json:"token_expires_at,omitempty"`
+	Health         SourceHealth `json:"health"`
+}
+
+// NewKISApiFromConfig 설정으로 KIS API 클라이언트 생성 (설정은 미리 검증되어 있어야 함)
+func NewKISApiFromConfig(config KISConfig) *KISApi {
+	k := NewKISApi(config.AppKey, config.AppSecret, config.AccountNo, config.AccountProdCode)
+	k.applyConfig(config)
+	return k
+}
+
+// applyConfig 환경, 주소, tr_id, 클라이언트 옵션 적용
+func (k *KISApi) applyConfig(config KISConfig) {
+	k.config = config
+	k.BaseURL = config.BaseURL
+	k.SetKISClientOptions(config.Timeout, config.RateLimit, config.MaxRetries)
+	// 환경이 바뀌면 캐시된 토큰을 다시 쓰지 않도록 캐시 키에 주소를 포함
+	k.tokens = NewTokenManager(k.issueToken, config.AppKey+"@"+config.BaseURL)
+}
+
+// Config 현재 KIS 설정
+func (k *KISApi) Config() KISConfig {
+	return k.config
+}
+
+// Status 현재 사용 중인 KIS 환경과 상태
+func (k *KISApi) Status() KISStatus {
+	status := KISStatus{
+		Env:        k.config.Env,
+		BaseURL:    k.BaseURL,
+		TrIDs:      k.config.TrIDs,
+		Account:    k.config.MaskedAccount(),
+		Timeout:    k.config.Timeout.String(),
+		RateLimit:  k.config.RateLimit,
+		MaxRetries: k.maxRetries,
+		Health:     k.Health(),
+	}
+	if expiresAt := k.tokens.ExpiresAt(); !expiresAt.IsZero() {
+		status.TokenExpiresAt = &expiresAt
+	}
+	return status
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 기존 텍스트 결제 로그(logs/payment_YYYY-MM-DD.log)에서 알아낸 기록 종류
+const (
+	LegacyPaymentTimeout   = "timeout"          // [중요] 결제 실패 - ... 타임아웃: 20초
+	LegacyPaymentMismatch  = "mismatch"         // 결제 실패 - ... 타임아웃: 13.4s초 (시도 중 예수금은 바뀌었지만 금액이 다름, 결과 아님)
+	LegacyPaymentCancelled = "cancelled"        // 결제 취소 요청 수신 / 결제 취소 처리 완료
+	LegacyPaymentUnderpaid = "underpaid"        // [주의] 부족 입금
+	LegacyPaymentOverpaid  = "overpaid"         // [주의] 초과 입금 (결제는 완료됨)
+	LegacyDepositMismatch  = "deposit_mismatch" // [중요] 예수금 일치하지 않음
+	LegacyDepositDrift     = "deposit_drift"    // [주의] 예수금 불일치 감지 (결제 확인 중 다른 입출금)
+)
+
+// LegacyLogEntry 기존 텍스트 결제 로그 한 줄에서 알아낸 기록
+type LegacyLogEntry struct {
+	Kind      string
+	File      string // 로그 파일 이름
+	Line      int    // 줄 번호 (1부터)
+	Time      time.Time
+	PaymentID string // 결제 ID (오래된 형식에는 없음)
+
+	Expected int64         // 요청 금액
+	Change   int64         // 최종 변동액 또는 입금액
+	Surplus  int64         // 초과 입금액
+	Elapsed  time.Duration // 타임아웃 또는 실패까지 걸린 시간
+	Attempt  int           // 취소 시점의 시도 횟수
+
+	InternalBalance int64 // 예수금 불일치 시 내부 상태 (불일치 감지 시 이전 예수금)
+	APIBalance      int64 // 예수금 불일치 시 KIS API 값 (불일치 감지 시 변동 전 현재 예수금)
+	Difference      int64
+}
+
+var (
+	legacyLinePattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) (.*)$`)
+
+	legacyFailurePattern = regexp.MustCompile(
+		`^(\[중요\] )?결제 실패 - (?:ID: ([0-9a-f-]+), )?요청 금액: (-?[\d,]+)원, 최종 변동액: (-?[\d,]+)원, 타임아웃: ([^초]+)초$`)
+	legacyCancelPattern      = regexp.MustCompile(`^결제 취소 요청 수신 - ID: ([0-9a-f-]+), 시도 #(\d+)에서 중단됨$`)
+	legacyCancelDonePattern  = regexp.MustCompile(`^결제 취소 처리 완료 - 결제 ID: ([0-9a-f-]+)$`)
+	legacyDepositPattern     = regexp.MustCompile(`^\[중요\] 예수금 일치하지 않음: 내부 상태 \((-?[\d,]+)원\) vs KIS API \((-?[\d,]+)원\), 차이: (-?[\d,]+)원$`)
+	legacyDriftPattern       = regexp.MustCompile(`^\[주의\] 예수금 불일치 감지 - ID: ([0-9a-f-]+), 이전: (-?[\d,]+)원, 현재\(변동 전\): (-?[\d,]+)원, 차이: (-?[\d,]+)원$`)
+	legacyUnderpaidPattern   = regexp.MustCompile(`^\[주의\] 부족 입금 - ID: ([0-9a-f-]+), 입금액: ([\d,]+)원, 요청 금액: ([\d,]+)원, 추가 입금 필요: ([\d,]+)원$`)
+	legacyOverpaidPattern    = regexp.MustCompile(`^\[주의\] 초과 입금 - ID: ([0-9a-f-]+), 입금액: ([\d,]+)원, 요청 금액: ([\d,]+)원, 환불 필요: ([\d,]+)원$`)
+	legacyLogFileNamePattern = regexp.MustCompile(`^payment_\d{4}-\d{2}-\d{2}\.log$`)
+)
+
+// parseWon "1,234" 형식의 원 단위 금액
+func parseWon(value string) int64 {
+	amount, _ := strconv.ParseInt(strings.ReplaceAll(value, ",", ""), 10, 64)
+	return amount
+}
+
+// parseLegacyElapsed "20"(초) 또는 "13.4s", "1m5.2s", "850ms" 형식(Go duration)의 걸린 시간
+func parseLegacyElapsed(value string) time.Duration {
+	if elapsed, err := time.ParseDuration(value); err == nil {
+		return elapsed
+	}
+	seconds, _ := strconv.ParseFloat(value, 64)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// LegacyPaymentLogFiles 디렉토리의 기존 텍스트 결제 로그 파일 (날짜 순)
+func LegacyPaymentLogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && legacyLogFileNamePattern.MatchString(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// ParseLegacyPaymentLog 기존 텍스트 결제 로그 파일을 읽어 결제/예수금 기록을 반환합니다.
+// 시각은 서버의 로컬 시간대로 해석하며, 알아볼 수 없는 줄(웹소켓 오류, 초기화 메시지 등)의 수를 함께 반환합니다.
+func ParseLegacyPaymentLog(path string) (entries []LegacyLogEntry, skipped int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	name := filepath.Base(path)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry, ok := ParseLegacyPaymentLine(line)
+		if !ok {
+			skipped++
+			continue
+		}
+		entry.File = name
+		entry.Line = lineNo
+		entries = append(entries, entry)
+	}
+	return entries, skipped, scanner.Err()
+}
+
+// ParseLegacyPaymentLine 기존 텍스트 결제 로그 한 줄 해석 (결제/예수금 기록이 아니면 ok=false)
+func ParseLegacyPaymentLine(line string) (entry LegacyLogEntry, ok bool) {
+	parts := legacyLinePattern.FindStringSubmatch(line)
+	if parts == nil {
+		return entry, false
+	}
+	timestamp, err := time.ParseInLocation("2006/01/02 15:04:05", parts[1], time.Local)
+	if err != nil {
+		return entry, false
+	}
+	entry.Time = timestamp
+	message := parts[2]
+
+	if m := legacyFailurePattern.FindStringSubmatch(message); m != nil {
+		entry.PaymentID = m[2]
+		entry.Expected = parseWon(m[3])
+		entry.Change = parseWon(m[4])
+		entry.Elapsed = parseLegacyElapsed(m[5])
+		// 시간 초과는 "[중요] ... 20초", 시도 중 금액 불일치는 "[중요]" 없이 실제 걸린 시간(Go duration)으로 기록되었음
+		entry.Kind = LegacyPaymentTimeout
+		if m[1] == "" {
+			entry.Kind = LegacyPaymentMismatch
+		}
+		return entry, true
+	}
+	if m := legacyCancelPattern.FindStringSubmatch(message); m != nil {
+		entry.Kind = LegacyPaymentCancelled
+		entry.PaymentID = m[1]
+		entry.Attempt, _ = strconv.Atoi(m[2])
+		return entry, true
+	}
+	if m := legacyCancelDonePattern.FindStringSubmatch(message); m != nil {
+		entry.Kind = LegacyPaymentCancelled
+		entry.PaymentID = m[1]
+		return entry, true
+	}
+	if m := legacyDepositPattern.FindStringSubmatch(message); m != nil {
+		entry.Kind = LegacyDepositMismatch
+		entry.InternalBalance = parseWon(m[1])
+		entry.APIBalance = parseWon(m[2])
+		entry.Difference = parseWon(m[3])
+		return entry, true
+	}
+	if m := legacyDriftPattern.FindStringSubmatch(message); m != nil {
+		entry.Kind = LegacyDepositDrift
+		entry.PaymentID = m[1]
+		entry.InternalBalance = parseWon(m[2])
+		entry.APIBalance = parseWon(m[3])
+		entry.Difference = parseWon(m[4])
+		return entry, true
+	}
+	if m := legacyUnderpaidPattern.FindStringSubmatch(message); m != nil {
+		entry.Kind = LegacyPaymentUnderpaid
+		entry.PaymentID = m[1]
+		entry.Change = parseWon(m[2])
+		entry.Expected = parseWon(m[3])
+		return entry, true
+	}
+	if m := legacyOverpaidPattern.FindStringSubmatch(message); m != nil {
+		entry.Kind = LegacyPaymentOverpaid
+		entry.PaymentID = m[1]
+		entry.Change = parseWon(m[2])
+		entry.Expected = parseWon(m[3])
+		entry.Surplus = parseWon(m[4])
+		return entry, true
+	}
+	return entry, false
+}
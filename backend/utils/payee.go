@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// DefaultTransferLinkTemplate 은행 코드가 설정되었을 때 사용하는 송금 딥링크 (카카오페이 계좌 송금 - 토스가 없는 고객용)
+const DefaultTransferLinkTemplate = "kakaotalk://kakaopay/money/to/bank?bank_code={bank_code}&bank_account_number={account_no}&amount={amount}"
+
+// PayeeConfig 고객이 입금할 계좌 (QR 코드와 딥링크에 사용)
+type PayeeConfig struct {
+	StoreName     string `json:"store_name,omitempty"`
+	BankName      string `json:"bank_name"`           // 토스 송금 화면에 표시되는 은행 이름 (예: 한국투자증권)
+	BankCode      string `json:"bank_code,omitempty"` // 금융결제원 은행 코드 (예: 한국투자증권 243)
+	AccountNo     string `json:"account_no"`
+	AccountHolder string `json:"account_holder,omitempty"`
+
+	// 토스 외의 송금 앱용 딥링크 주소 형식 ({bank_code}, {bank_name}, {account_no}, {amount}, {holder}를 채움)
+	TransferLinkTemplate string `json:"-"`
+}
+
+// LoadPayeeConfigFromEnv 환경 변수에서 입금 계좌를 읽습니다.
+//
+//	PAYEE_BANK_NAME       은행 이름 (기본값: 한국투자증권)
+//	PAYEE_BANK_CODE       금융결제원 은행 코드 (설정하면 기본 송금 딥링크 사용)
+//	PAYEE_ACCOUNT_NO      계좌번호 (숫자와 '-'만)
+//	PAYEE_ACCOUNT_HOLDER  예금주
+//	PAYEE_TRANSFER_LINK   송금 딥링크 주소 형식 (비어 있으면 은행 코드가 있을 때 DefaultTransferLinkTemplate)
+//	STORE_NAME            가게 이름
+func LoadPayeeConfigFromEnv() (PayeeConfig, error) {
+	config := PayeeConfig{
+		StoreName:            os.Getenv("STORE_NAME"),
+		BankName:             os.Getenv("PAYEE_BANK_NAME"),
+		BankCode:             os.Getenv("PAYEE_BANK_CODE"),
+		AccountNo:            os.Getenv("PAYEE_ACCOUNT_NO"),
+		AccountHolder:        os.Getenv("PAYEE_ACCOUNT_HOLDER"),
+		TransferLinkTemplate: os.Getenv("PAYEE_TRANSFER_LINK"),
+	}
+	if config.BankName == "" {
+		config.BankName = "한국투자증권"
+	}
+	if config.TransferLinkTemplate == "" && config.BankCode != "" {
+		config.TransferLinkTemplate = DefaultTransferLinkTemplate
+	}
+	return config, config.Validate()
+}
+
+// Validate 설정 검증
+func (p PayeeConfig) Validate() error {
+	if p.AccountNo == "" {
+		return fmt.Errorf("입금 계좌번호(PAYEE_ACCOUNT_NO)가 설정되지 않았습니다")
+	}
+	if strings.Trim(p.AccountNo, "0123456789-") != "" {
+		return fmt.Errorf("입금 계좌번호에는 숫자와 '-'만 사용할 수 있습니다: %s", p.AccountNo)
+	}
+	if p.BankName == "" {
+		return fmt.Errorf("입금 은행 이름(PAYEE_BANK_NAME)이 비어 있습니다")
+	}
+	if p.BankCode != "" && strings.Trim(p.BankCode, "0123456789") != "" {
+		return fmt.Errorf("은행 코드(PAYEE_BANK_CODE)는 숫자여야 합니다: %s", p.BankCode)
+	}
+	if p.TransferLinkTemplate != "" {
+		if !strings.Contains(p.TransferLinkTemplate, "{account_no}") || !strings.Contains(p.TransferLinkTemplate, "{amount}") {
+			return fmt.Errorf("송금 딥링크(PAYEE_TRANSFER_LINK)에는 {account_no}와 {amount}가 있어야 합니다")
+		}
+		if strings.Contains(p.TransferLinkTemplate, "{bank_code}") && p.BankCode == "" {
+			return fmt.Errorf("송금 딥링크에 {bank_code}를 쓰려면 은행 코드(PAYEE_BANK_CODE)가 필요합니다")
+		}
+	}
+	return nil
+}
+
+// ForAccount 같은 은행, 예금주로 다른 계좌번호에 입금받는 설정
+func (p PayeeConfig) ForAccount(accountNo string) *PayeeConfig {
+	p.AccountNo = accountNo
+	return &p
+}
+
+// accountDigits '-'를 뺀 계좌번호
+func (p PayeeConfig) accountDigits() string {
+	return strings.ReplaceAll(p.AccountNo, "-", "")
+}
+
+// TossSendLink 금액이 채워진 토스 송금 딥링크
+func (p PayeeConfig) TossSendLink(amount int64) string {
+	params := url.Values{}
+	params.Set("amount", fmt.Sprintf("%d", amount))
+	params.Set("bank", p.BankName)
+	params.Set("accountNo", p.accountDigits())
+	params.Set("origin", "qr")
+	return "supertoss://send?" + params.Encode()
+}
+
+// TransferLink 금액이 채워진 송금 딥링크 (토스 외의 송금 앱, 설정되지 않았으면 빈 문자열)
+func (p PayeeConfig) TransferLink(amount int64) string {
+	if p.TransferLinkTemplate == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{bank_code}", url.QueryEscape(p.BankCode),
+		"{bank_name}", url.QueryEscape(p.BankName),
+		"{account_no}", url.QueryEscape(p.accountDigits()),
+		"{amount}", fmt.Sprintf("%d", amount),
+		"{holder}", url.QueryEscape(p.AccountHolder),
+	).Replace(p.TransferLinkTemplate)
+}
+
+// TransferText 다른 은행 앱에서 직접 이체할 때 보여줄 안내 문구
+func (p PayeeConfig) TransferText(amount int64) string {
+	text := fmt.Sprintf("%s %s", p.BankName, p.AccountNo)
+	if p.AccountHolder != "" {
+		text += fmt.Sprintf(" (%s)", p.AccountHolder)
+	}
+	return fmt.Sprintf("%s / %s원", text, FormatNumber(amount))
+}
+
+// QRCodePNG 내용을 담은 PNG QR 코드
+func QRCodePNG(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, size)
+}
+
+// QRCodeSVG 내용을 담은 SVG QR 코드 (모듈 하나당 1 단위, 크기는 viewBox로 조절)
+func QRCodeSVG(content string) (string, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
+	bitmap := qr.Bitmap() // 여백 포함
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	size := len(bitmap)
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		size, size, size, size, path.String()), nil
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 결제 로그 수준
+const (
+	PaymentLogInfo  = "info"
+	PaymentLogWarn  = "warn"  // 직원 확인이 필요할 수 있는 상황 (부족/초과 입금 등)
+	PaymentLogError = "error" // 기록 실패 등 즉시 확인이 필요한 오류
+)
+
+// PaymentLogEvent 결제 감사 로그 한 줄 (JSON Lines)
+type PaymentLogEvent struct {
+	Time          time.Time `json:"time"`
+	Type          string    `json:"type"`
+	Level         string    `json:"level"`
+	PaymentID     string    `json:"payment_id,omitempty"`
+	OrderID       uint      `json:"order_id,omitempty"`
+	Account       string    `json:"account,omitempty"`        // 입금 계좌 ID
+	Status        string    `json:"status,omitempty"`         // 결제/환불 상태
+	Amount        int64     `json:"amount,omitempty"`         // 이 이벤트의 금액 (할당액, 환불액 등)
+	Expected      int64     `json:"expected,omitempty"`       // 입금되어야 할 금액
+	Received      int64     `json:"received,omitempty"`       // 지금까지 입금된 금액
+	DepositBefore *int64    `json:"deposit_before,omitempty"` // 변동 전 예수금
+	DepositAfter  *int64    `json:"deposit_after,omitempty"`  // 변동 후 예수금
+	Attempt       int       `json:"attempt,omitempty"`
+	Message       string    `json:"message"`
+}
+
+// PaymentLogFilter 결제 로그 조회 조건 (비어 있는 조건은 무시)
+type PaymentLogFilter struct {
+	Date      string // YYYY-MM-DD (로컬 날짜)
+	PaymentID string
+	OrderID   uint
+	Type      string
+	Level     string
+}
+
+// matches 이벤트가 조회 조건에 맞는지
+func (f PaymentLogFilter) matches(event PaymentLogEvent) bool {
+	return (f.PaymentID == "" || event.PaymentID == f.PaymentID) &&
+		(f.OrderID == 0 || event.OrderID == f.OrderID) &&
+		(f.Type == "" || event.Type == f.Type) &&
+		(f.Level == "" || event.Level == f.Level)
+}
+
+// PaymentLog 날짜별 JSON Lines 파일에 결제 이벤트를 기록합니다.
+// 로컬 자정이 지나면 새 파일(payment_YYYY-MM-DD.jsonl)로 넘어가고, 보관 기간이 지난 파일은 삭제합니다.
+type PaymentLog struct {
+	dir           string
+	retentionDays int // 0이면 삭제하지 않음
+
+	mu   sync.Mutex
+	file *os.File
+	date string // 현재 열린 파일의 날짜
+}
+
+// paymentLogDateFormat 로그 파일 이름의 날짜 형식
+const paymentLogDateFormat = "2006-01-02"
+
+// NewPaymentLog 새로운 PaymentLog 생성 (오늘 파일을 열고 오래된 파일을 정리)
+func NewPaymentLog(dir string, retentionDays int) (*PaymentLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("로그 디렉토리 생성 실패: %v", err)
+	}
+	l := &PaymentLog{dir: dir, retentionDays: retentionDays}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.rotateLocked(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// path 날짜별 로그 파일 경로
+func (l *PaymentLog) path(date string) string {
+	return filepath.Join(l.dir, fmt.Sprintf("payment_%s.jsonl", date))
+}
+
+// rotateLocked now의 로컬 날짜 파일이 열려 있지 않으면 새로 열고 오래된 파일을 정리합니다 (l.mu 잠금 상태에서 호출)
+func (l *PaymentLog) rotateLocked(now time.Time) error {
+	date := now.Local().Format(paymentLogDateFormat)
+	if l.file != nil && l.date == date {
+		return nil
+	}
+
+	file, err := os.OpenFile(l.path(date), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("로그 파일 생성 실패: %v", err)
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.date = date
+
+	l.pruneLocked(now)
+	return nil
+}
+
+// pruneLocked 보관 기간이 지난 로그 파일 삭제 (l.mu 잠금 상태에서 호출)
+func (l *PaymentLog) pruneLocked(now time.Time) {
+	if l.retentionDays <= 0 {
+		return
+	}
+	cutoff := now.Local().AddDate(0, 0, -l.retentionDays).Format(paymentLogDateFormat)
+	for _, date := range l.datesLocked() {
+		if date < cutoff {
+			os.Remove(l.path(date))
+		}
+	}
+}
+
+// datesLocked 로그 파일이 있는 날짜 목록 (오래된 순)
+func (l *PaymentLog) datesLocked() []string {
+	files, _ := filepath.Glob(filepath.Join(l.dir, "payment_*.jsonl"))
+	dates := make([]string, 0, len(files))
+	for _, file := range files {
+		date := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "payment_"), ".jsonl")
+		if _, err := time.Parse(paymentLogDateFormat, date); err == nil {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// Write 이벤트 한 줄 기록 (Time이 비어 있으면 현재 시각)
+func (l *PaymentLog) Write(event PaymentLogEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Level == "" {
+		event.Level = PaymentLogInfo
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.rotateLocked(time.Now()); err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close 열린 로그 파일 닫기
+func (l *PaymentLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Query 조건에 맞는 이벤트를 시간 순으로 반환합니다.
+// 날짜를 지정하지 않으면 결제/주문 조건이 있을 때는 보관 중인 모든 파일을, 없으면 오늘 파일만 검색합니다.
+func (l *PaymentLog) Query(filter PaymentLogFilter) ([]PaymentLogEvent, error) {
+	l.mu.Lock()
+	var dates []string
+	switch {
+	case filter.Date != "":
+		dates = []string{filter.Date}
+	case filter.PaymentID != "" || filter.OrderID != 0:
+		dates = l.datesLocked()
+	default:
+		dates = []string{time.Now().Format(paymentLogDateFormat)}
+	}
+	l.mu.Unlock()
+
+	events := []PaymentLogEvent{}
+	for _, date := range dates {
+		file, err := os.Open(l.path(date))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var event PaymentLogEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				continue // 기록 중 잘린 줄 등은 건너뜀
+			}
+			if filter.matches(event) {
+				events = append(events, event)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
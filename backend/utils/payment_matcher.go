@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSubsetCandidates 여러 건의 입금이 한 번에 들어왔을 때 조합을 탐색할 최대 대기 결제 수
+const maxSubsetCandidates = 16
+
+// DefaultMatchTolerancePercent 금액이 다른 입금을 하나뿐인 대기 결제에 할당할 때 허용하는 차이 (입금되지 않은 금액 대비 %)
+const DefaultMatchTolerancePercent = 50
+
+// PendingPayment 입금을 기다리는 결제
+type PendingPayment struct {
+	PaymentID    string    `json:"payment_id"`
+	BaseAmount   int64     `json:"base_amount"` // 주문 금액
+	Amount       int64     `json:"amount"`      // 입금되어야 할 금액 (BaseAmount + 오프셋)
+	Received     int64     `json:"received"`    // 지금까지 할당된 입금액 (부족 입금 후 추가 입금 대기 시)
+	RegisteredAt time.Time `json:"registered_at"`
+	seq          uint64
+}
+
+// Outstanding 아직 입금되지 않은 금액
+func (p *PendingPayment) Outstanding() int64 {
+	return p.Amount - p.Received
+}
+
+// PaymentMatch 입금 변동액이 할당된 결제
+type PaymentMatch struct {
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`   // 이번 변동에서 할당된 금액
+	Received  int64  `json:"received"` // 지금까지 할당된 입금액 합계
+	Expected  int64  `json:"expected"` // 입금되어야 할 금액
+}
+
+// Complete 입금되어야 할 금액이 모두 입금되었는지 (초과 입금 포함)
+func (m PaymentMatch) Complete() bool {
+	return m.Received >= m.Expected
+}
+
+// Surplus 초과 입금액
+func (m PaymentMatch) Surplus() int64 {
+	if m.Received <= m.Expected {
+		return 0
+	}
+	return m.Received - m.Expected
+}
+
+// PaymentMatcher 대기 중인 결제들의 기대 금액을 함께 관리하고
+// 관측된 예수금 변동액을 결정적으로 결제에 할당합니다.
+//
+// 할당 규칙 (금액은 아직 입금되지 않은 금액 기준):
+//  1. 변동액과 금액이 같은 결제 중 가장 먼저 등록된 결제
+//  2. 합이 변동액과 같은 결제 조합 중 결제 수가 가장 적고, 먼저 등록된 결제로 이루어진 조합
+//  3. 대기 중인 결제가 하나뿐이고 변동액이 허용 범위(입금되지 않은 금액의 ±tolerance%) 안이면
+//     금액이 달라도 그 결제에 할당 (부족/초과 입금)
+//     부족 입금된 결제는 나머지 금액의 추가 입금을 기다리며 대기 목록에 남습니다.
+//
+// 어느 규칙에도 맞지 않는 변동액(급여 입금 등 결제와 무관한 입출금)은 할당하지 않고 돌려주며,
+// 호출자는 이를 직원 확인이 필요한 변동으로 남깁니다.
+//
+// maxOffset이 0보다 크면 등록 시 0~maxOffset원의 오프셋을 더해
+// 대기 중인 결제끼리 금액이 겹치지 않도록 합니다.
+type PaymentMatcher struct {
+	mu        sync.Mutex
+	pending   map[string]*PendingPayment
+	seq       uint64
+	maxOffset int64
+	tolerance int64 // 규칙 3의 허용 차이 (%, 0이면 정확히 일치하는 입금만 할당)
+}
+
+// NewPaymentMatcher 새로운 PaymentMatcher 생성
+func NewPaymentMatcher(maxOffset int64) *PaymentMatcher {
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	return &PaymentMatcher{
+		pending:   make(map[string]*PendingPayment),
+		maxOffset: maxOffset,
+		tolerance: DefaultMatchTolerancePercent,
+	}
+}
+
+// SetMaxOffset 금액 오프셋 최대값 설정 (0이면 오프셋 사용 안 함)
+func (m *PaymentMatcher) SetMaxOffset(maxOffset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	m.maxOffset = maxOffset
+}
+
+// SetTolerance 금액이 다른 입금을 하나뿐인 대기 결제에 할당할 때 허용하는 차이 설정 (%, 0이면 할당 안 함)
+func (m *PaymentMatcher) SetTolerance(percent int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if percent < 0 {
+		percent = 0
+	}
+	m.tolerance = percent
+}
+
+// Register 결제를 대기 목록에 등록하고 실제로 입금받을 금액을 반환합니다
+func (m *PaymentMatcher) Register(paymentID string, baseAmount int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.pending[paymentID]; exists {
+		return 0, fmt.Errorf("이미 등록된 결제입니다: %s", paymentID)
+	}
+
+	amount := baseAmount
+	if m.maxOffset > 0 {
+		found := false
+		for offset := int64(0); offset <= m.maxOffset; offset++ {
+			if !m.amountInUse(baseAmount + offset) {
+				amount = baseAmount + offset
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("같은 금액(%s원)의 결제가 너무 많이 진행 중입니다", FormatNumber(baseAmount))
+		}
+	}
+
+	m.seq++
+	m.pending[paymentID] = &PendingPayment{
+		PaymentID:    paymentID,
+		BaseAmount:   baseAmount,
+		Amount:       amount,
+		RegisteredAt: time.Now(),
+		seq:          m.seq,
+	}
+	return amount, nil
+}
+
+// RegisterExact 오프셋 없이 정해진 금액으로 결제를 등록합니다 (서버 재시작 후 기존 결제를 이어서 기다릴 때)
+func (m *PaymentMatcher) RegisterExact(paymentID string, amount int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.pending[paymentID]; exists {
+		return fmt.Errorf("이미 등록된 결제입니다: %s", paymentID)
+	}
+
+	m.seq++
+	m.pending[paymentID] = &PendingPayment{
+		PaymentID:    paymentID,
+		BaseAmount:   amount,
+		Amount:       amount,
+		RegisteredAt: time.Now(),
+		seq:          m.seq,
+	}
+	return nil
+}
+
+// amountInUse 대기 중인 결제 중 같은 금액이 있는지 확인 (잠금 상태에서 호출)
+func (m *PaymentMatcher) amountInUse(amount int64) bool {
+	for _, p := range m.pending {
+		if p.Amount == amount || p.Outstanding() == amount {
+			return true
+		}
+	}
+	return false
+}
+
+// Unregister 결제를 대기 목록에서 제거
+func (m *PaymentMatcher) Unregister(paymentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, paymentID)
+}
+
+// Pending 대기 중인 결제 목록 (등록 순)
+func (m *PaymentMatcher) Pending() []PendingPayment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]PendingPayment, 0, len(m.pending))
+	for _, p := range m.sortedPending() {
+		result = append(result, *p)
+	}
+	return result
+}
+
+// Has 결제가 대기 목록에 있는지 확인
+func (m *PaymentMatcher) Has(paymentID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.pending[paymentID]
+	return ok
+}
+
+// PendingCount 대기 중인 결제 수
+func (m *PaymentMatcher) PendingCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pending)
+}
+
+// sortedPending 등록 순으로 정렬된 대기 결제 (잠금 상태에서 호출)
+func (m *PaymentMatcher) sortedPending() []*PendingPayment {
+	list := make([]*PendingPayment, 0, len(m.pending))
+	for _, p := range m.pending {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+	return list
+}
+
+// Match 관측된 변동액을 대기 중인 결제에 할당합니다.
+// 입금이 끝난 결제는 대기 목록에서 제거되며, 어떤 결제에도 할당되지 않은 금액은 remainder로 반환됩니다.
+func (m *PaymentMatcher) Match(delta int64) (matches []PaymentMatch, remainder int64) {
+	if delta <= 0 {
+		return nil, delta
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	candidates := m.sortedPending()
+
+	// 1. 단일 결제 정확히 일치
+	for _, p := range candidates {
+		if p.Outstanding() == delta {
+			return []PaymentMatch{m.assign(p, delta)}, 0
+		}
+	}
+
+	// 2. 여러 결제의 합과 일치 (한 번의 조회 사이에 여러 건이 입금된 경우)
+	if len(candidates) > maxSubsetCandidates {
+		candidates = candidates[:maxSubsetCandidates]
+	}
+	for size := 2; size <= len(candidates); size++ {
+		if subset := findSubset(candidates, size, delta); subset != nil {
+			for _, p := range subset {
+				matches = append(matches, m.assign(p, p.Outstanding()))
+			}
+			return matches, 0
+		}
+	}
+
+	// 3. 대기 중인 결제가 하나뿐이고 금액 차이가 허용 범위 안이면 부족/초과 입금으로 할당
+	if len(m.pending) == 1 && m.withinTolerance(candidates[0], delta) {
+		return []PaymentMatch{m.assign(candidates[0], delta)}, 0
+	}
+
+	return nil, delta
+}
+
+// withinTolerance 변동액과 입금되지 않은 금액의 차이가 허용 범위 안인지 (잠금 상태에서 호출)
+func (m *PaymentMatcher) withinTolerance(p *PendingPayment, delta int64) bool {
+	outstanding := p.Outstanding()
+	diff := delta - outstanding
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff*100 <= outstanding*m.tolerance
+}
+
+// assign 결제에 입금액을 할당하고, 입금이 끝났으면 대기 목록에서 제거합니다 (잠금 상태에서 호출)
+func (m *PaymentMatcher) assign(p *PendingPayment, amount int64) PaymentMatch {
+	p.Received += amount
+	if p.Outstanding() <= 0 {
+		delete(m.pending, p.PaymentID)
+	}
+	return PaymentMatch{PaymentID: p.PaymentID, Amount: amount, Received: p.Received, Expected: p.Amount}
+}
+
+// findSubset 등록 순으로 조합을 탐색하여 합이 target인 size개의 결제를 찾습니다
+func findSubset(candidates []*PendingPayment, size int, target int64) []*PendingPayment {
+	indices := make([]int, size)
+	for i := range indices {
+		indices[i] = i
+	}
+
+	for {
+		var sum int64
+		for _, idx := range indices {
+			sum += candidates[idx].Outstanding()
+		}
+		if sum == target {
+			subset := make([]*PendingPayment, size)
+			for i, idx := range indices {
+				subset[i] = candidates[idx]
+			}
+			return subset
+		}
+
+		// 다음 조합 (사전순)
+		i := size - 1
+		for i >= 0 && indices[i] == len(candidates)-size+i {
+			i--
+		}
+		if i < 0 {
+			return nil
+		}
+		indices[i]++
+		for j := i + 1; j < size; j++ {
+			indices[j] = indices[j-1] + 1
+		}
+	}
+}
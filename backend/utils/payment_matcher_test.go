@@ -0,0 +1,200 @@
+package utils
+
+import "testing"
+
+func TestMatchSinglePendingWithinTolerance(t *testing.T) {
+	m := NewPaymentMatcher(0)
+	if _, err := m.Register("p1", 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	// 부족 입금 - 나머지 금액을 기다리며 대기 목록에 남음
+	matches, remainder := m.Match(3000)
+	if remainder != 0 || len(matches) != 1 || matches[0].PaymentID != "p1" || matches[0].Complete() {
+		t.Fatalf("부족 입금 할당 = %+v (남은 금액 %d), want p1에 3000원 미완료", matches, remainder)
+	}
+	if !m.Has("p1") {
+		t.Fatal("부족 입금된 결제가 대기 목록에서 빠짐")
+	}
+
+	// 나머지 금액보다 조금 많이 입금 - 초과 입금으로 완료
+	matches, remainder = m.Match(2500)
+	if remainder != 0 || len(matches) != 1 || !matches[0].Complete() || matches[0].Surplus() != 500 {
+		t.Fatalf("초과 입금 할당 = %+v (남은 금액 %d), want 500원 초과로 완료", matches, remainder)
+	}
+}
+
+func TestMatchSinglePendingOutsideToleranceIsUnmatched(t *testing.T) {
+	m := NewPaymentMatcher(0)
+	if _, err := m.Register("p1", 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	// 결제와 무관한 큰 입금과 작은 입금은 할당하지 않음
+	for _, delta := range []int64{500000, 1000} {
+		matches, remainder := m.Match(delta)
+		if len(matches) != 0 || remainder != delta {
+			t.Fatalf("%d원 변동 할당 = %+v (남은 금액 %d), want 할당 안 함", delta, matches, remainder)
+		}
+	}
+	if !m.Has("p1") {
+		t.Fatal("할당되지 않은 입금으로 결제가 대기 목록에서 빠짐")
+	}
+}
+
+func TestMatchToleranceZeroRequiresExactAmount(t *testing.T) {
+	m := NewPaymentMatcher(0)
+	m.SetTolerance(0)
+	if _, err := m.Register("p1", 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	if matches, remainder := m.Match(2990); len(matches) != 0 || remainder != 2990 {
+		t.Fatalf("허용 범위 0에서 2990원 할당 = %+v (남은 금액 %d), want 할당 안 함", matches, remainder)
+	}
+	if matches, remainder := m.Match(3000); len(matches) != 1 || remainder != 0 {
+		t.Fatalf("허용 범위 0에서 3000원 할당 = %+v (남은 금액 %d), want p1", matches, remainder)
+	}
+}
+
+func TestMatchMultiplePending(t *testing.T) {
+	type pending struct {
+		id     string
+		amount int64
+	}
+	tests := []struct {
+		name          string
+		pending       []pending
+		delta         int64
+		want          map[string]int64 // 결제별 할당 금액
+		wantRemainder int64
+	}{
+		{
+			name:    "같은 금액의 결제는 먼저 등록된 결제에 할당",
+			pending: []pending{{"p1", 4500}, {"p2", 4500}},
+			delta:   4500,
+			want:    map[string]int64{"p1": 4500},
+		},
+		{
+			name:    "한 번의 조회 사이에 두 결제가 입금됨",
+			pending: []pending{{"p1", 4500}, {"p2", 9000}},
+			delta:   13500,
+			want:    map[string]int64{"p1": 4500, "p2": 9000},
+		},
+		{
+			name:    "결제 수가 가장 적은 조합",
+			pending: []pending{{"p1", 1000}, {"p2", 2000}, {"p3", 3000}, {"p4", 5000}},
+			delta:   6000,
+			want:    map[string]int64{"p1": 1000, "p4": 5000},
+		},
+		{
+			name:    "결제 수가 같은 조합은 먼저 등록된 결제로 이루어진 조합",
+			pending: []pending{{"p1", 1000}, {"p2", 2000}, {"p3", 3000}, {"p4", 4000}},
+			delta:   5000,
+			want:    map[string]int64{"p1": 1000, "p4": 4000},
+		},
+		{
+			name:          "대기 결제가 여럿이면 금액이 다른 입금은 할당 안 함",
+			pending:       []pending{{"p1", 4500}, {"p2", 9000}},
+			delta:         4400,
+			wantRemainder: 4400,
+		},
+		{
+			name:          "합이 맞는 조합이 없는 입금은 할당 안 함",
+			pending:       []pending{{"p1", 4500}, {"p2", 9000}},
+			delta:         6000,
+			wantRemainder: 6000,
+		},
+		{
+			name:          "모든 결제의 합보다 큰 입금은 할당 안 함",
+			pending:       []pending{{"p1", 4500}, {"p2", 9000}},
+			delta:         20000,
+			wantRemainder: 20000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPaymentMatcher(0)
+			for _, p := range tt.pending {
+				if _, err := m.Register(p.id, p.amount); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			matches, remainder := m.Match(tt.delta)
+			if remainder != tt.wantRemainder {
+				t.Fatalf("남은 금액 = %d, want %d", remainder, tt.wantRemainder)
+			}
+			got := make(map[string]int64)
+			for _, match := range matches {
+				got[match.PaymentID] = match.Amount
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("할당 = %v, want %v", got, tt.want)
+			}
+			for id, amount := range tt.want {
+				if got[id] != amount {
+					t.Fatalf("할당 = %v, want %v", got, tt.want)
+				}
+			}
+
+			// 할당된 결제만 대기 목록에서 빠짐
+			for _, p := range tt.pending {
+				if _, matched := tt.want[p.id]; m.Has(p.id) == matched {
+					t.Fatalf("%s 대기 여부 = %v, want %v", p.id, m.Has(p.id), !matched)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterOffsetsKeepAmountsUnique(t *testing.T) {
+	m := NewPaymentMatcher(2)
+
+	for _, want := range []struct {
+		id     string
+		amount int64
+	}{{"a", 4500}, {"b", 4501}, {"c", 4502}} {
+		amount, err := m.Register(want.id, 4500)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if amount != want.amount {
+			t.Fatalf("%s 결제 금액 = %d, want %d", want.id, amount, want.amount)
+		}
+	}
+	if _, err := m.Register("d", 4500); err == nil {
+		t.Fatal("오프셋을 모두 사용했는데 같은 금액의 결제가 등록됨")
+	}
+
+	// 취소된 결제의 금액은 다시 사용
+	m.Unregister("b")
+	if amount, err := m.Register("e", 4500); err != nil || amount != 4501 {
+		t.Fatalf("취소 후 결제 금액 = %d (%v), want 4501", amount, err)
+	}
+
+	// 입금이 끝난 결제의 금액도 다시 사용
+	if matches, _ := m.Match(4500); len(matches) != 1 || matches[0].PaymentID != "a" {
+		t.Fatalf("4500원 할당 = %+v, want a", matches)
+	}
+	if amount, err := m.Register("f", 4500); err != nil || amount != 4500 {
+		t.Fatalf("입금 완료 후 결제 금액 = %d (%v), want 4500", amount, err)
+	}
+}
+
+func TestRegisterOffsetAvoidsOutstandingAmount(t *testing.T) {
+	m := NewPaymentMatcher(2)
+	if _, err := m.Register("p1", 6000); err != nil {
+		t.Fatal(err)
+	}
+	// 부족 입금으로 2,000원이 남은 결제
+	if matches, _ := m.Match(4000); len(matches) != 1 || matches[0].Complete() {
+		t.Fatalf("4000원 할당 = %+v, want p1에 부족 입금", matches)
+	}
+
+	// 남은 금액과 같은 금액의 새 결제는 오프셋으로 구분
+	if amount, err := m.Register("p2", 2000); err != nil || amount != 2001 {
+		t.Fatalf("새 결제 금액 = %d (%v), want 2001", amount, err)
+	}
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 예수금 조회 간격 하한 (KIS 초당 호출 제한을 넘지 않도록)
+const minPollInterval = 200 * time.Millisecond
+
+// Duration JSON에서 "1.5s", "3m" 같은 문자열(또는 초 단위 숫자)로 표현되는 시간
+type Duration time.Duration
+
+// MarshalJSON "1.5s" 형식으로 기록
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON 문자열("90s")이나 초 단위 숫자(90)를 읽음
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("잘못된 시간 형식: %s", v)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("잘못된 시간 형식: %s", string(data))
+	}
+	return nil
+}
+
+// PollingStage 결제 시작 후 After가 지난 뒤부터 적용되는 예수금 조회 간격
+type PollingStage struct {
+	After    Duration `json:"after"`
+	Interval Duration `json:"interval"`
+}
+
+// PaymentPolicy 입금 대기 정책 (조회 간격 곡선, 대기 시간, 키오스크에 표시할 카운트다운)
+type PaymentPolicy struct {
+	Timeout        Duration       `json:"timeout"`          // 고객에게 보여주는 입금 대기 시간
+	GracePeriod    Duration       `json:"grace_period"`     // 시간 초과 후 늦게 확인되는 입금을 계속 기다리는 시간
+	TopUpWait      Duration       `json:"top_up_wait"`      // 부족 입금 후 추가 입금을 기다리는 최소 시간
+	MaxOutagePause Duration       `json:"max_outage_pause"` // 은행 조회 장애 중 대기 시간을 멈출 수 있는 최대 시간
+	CountdownStep  Duration       `json:"countdown_step"`   // 상태 전송 주기 (payment_status의 attempt/max_attempts 단위)
+	Schedule       []PollingStage `json:"schedule"`         // 경과 시간별 예수금 조회 간격 (After 순)
+}
+
+// DefaultPaymentPolicy 기본 정책 - 180초 동안 일정한 간격으로 조회
+func DefaultPaymentPolicy(pollInterval time.Duration) PaymentPolicy {
+	if pollInterval <= 0 {
+		pollInterval = DefaultDepositPollInterval
+	}
+	return PaymentPolicy{
+		Timeout:        Duration(180 * time.Second),
+		TopUpWait:      Duration(60 * time.Second),
+		MaxOutagePause: Duration(120 * time.Second),
+		CountdownStep:  Duration(1 * time.Second),
+		Schedule:       []PollingStage{{After: 0, Interval: Duration(pollInterval)}},
+	}
+}
+
+// Validate 정책 검증 (조회 간격 곡선은 After 순으로 정렬됨)
+func (p *PaymentPolicy) Validate() error {
+	if p.Timeout <= 0 {
+		return fmt.Errorf("입금 대기 시간(timeout)은 0보다 커야 합니다")
+	}
+	if p.GracePeriod < 0 || p.TopUpWait < 0 || p.MaxOutagePause < 0 {
+		return fmt.Errorf("grace_period, top_up_wait, max_outage_pause는 음수일 수 없습니다")
+	}
+	if time.Duration(p.CountdownStep) < minPollInterval {
+		return fmt.Errorf("카운트다운 단위(countdown_step)는 %v 이상이어야 합니다", minPollInterval)
+	}
+	if p.CountdownStep > p.Timeout {
+		return fmt.Errorf("카운트다운 단위(countdown_step)는 입금 대기 시간보다 길 수 없습니다")
+	}
+	if len(p.Schedule) == 0 {
+		return fmt.Errorf("예수금 조회 간격(schedule)이 비어 있습니다")
+	}
+
+	sort.SliceStable(p.Schedule, func(i, j int) bool { return p.Schedule[i].After < p.Schedule[j].After })
+	if p.Schedule[0].After != 0 {
+		return fmt.Errorf("첫 번째 조회 구간은 after: 0s 로 시작해야 합니다")
+	}
+	for i, stage := range p.Schedule {
+		if time.Duration(stage.Interval) < minPollInterval {
+			return fmt.Errorf("조회 간격은 %v 이상이어야 합니다 (구간 %d)", minPollInterval, i+1)
+		}
+		if i > 0 && stage.After == p.Schedule[i-1].After {
+			return fmt.Errorf("같은 시작 시간의 조회 구간이 두 개 있습니다: %v", time.Duration(stage.After))
+		}
+	}
+	return nil
+}
+
+// PollInterval 결제 시작 후 elapsed가 지났을 때의 예수금 조회 간격
+func (p PaymentPolicy) PollInterval(elapsed time.Duration) time.Duration {
+	interval := time.Duration(p.Schedule[0].Interval)
+	for _, stage := range p.Schedule {
+		if elapsed < time.Duration(stage.After) {
+			break
+		}
+		interval = time.Duration(stage.Interval)
+	}
+	return interval
+}
+
+// Steps 시간을 카운트다운 단위 수로 변환 (내림)
+func (p PaymentPolicy) Steps(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(d / time.Duration(p.CountdownStep))
+}
+
+// PaymentPolicyStore 현재 입금 대기 정책 (관리자가 바꾸면 파일에 저장되어 재시작 후에도 유지)
+type PaymentPolicyStore struct {
+	path string // 비어 있으면 저장하지 않음
+
+	mu     sync.RWMutex
+	policy PaymentPolicy
+}
+
+// LoadPaymentPolicy 정책 파일을 읽습니다. 파일이 없으면 fallback을 사용합니다.
+func LoadPaymentPolicy(path string, fallback PaymentPolicy) (*PaymentPolicyStore, error) {
+	store := &PaymentPolicyStore{path: path, policy: fallback}
+	if path == "" {
+		return store, fallback.Validate()
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, fallback.Validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var policy PaymentPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	store.policy = policy
+	return store, nil
+}
+
+// Get 현재 정책
+func (s *PaymentPolicyStore) Get() PaymentPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// PollInterval 현재 정책의 경과 시간별 예수금 조회 간격 (폴러에서 사용)
+func (s *PaymentPolicyStore) PollInterval(elapsed time.Duration) time.Duration {
+	return s.Get().PollInterval(elapsed)
+}
+
+// Update 정책을 검증하고 파일에 저장한 뒤 적용합니다 (새로 시작하는 결제부터 대기 시간이 적용됨)
+func (s *PaymentPolicyStore) Update(policy PaymentPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path != "" {
+		data, err := json.MarshalIndent(policy, "", "  ")
+		if err != nil {
+			return err
+		}
+		tmp := s.path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return fmt.Errorf("정책 파일 저장 실패: %v", err)
+		}
+		if err := os.Rename(tmp, s.path); err != nil {
+			return fmt.Errorf("정책 파일 저장 실패: %v", err)
+		}
+	}
+	s.policy = policy
+	return nil
+}
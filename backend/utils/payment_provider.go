@@ -0,0 +1,448 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 결제 제공자 이름
+const (
+	ProviderKIS       = "kis"
+	ProviderSimulator = "simulator"
+)
+
+// PaymentProvider 입금 확인 방식을 추상화한 인터페이스
+// 결제 세션은 Start로 입금 대기를 시작하고, Confirmed 채널로 확인을 기다리며,
+// 취소/시간 초과 시 Cancel로 대기를 해제합니다.
+type PaymentProvider interface {
+	// Name 제공자 이름
+	Name() string
+	// Start 입금 계좌를 정해 입금 대기를 시작하고 고객이 입금해야 할 금액과 입금 확인 채널을 반환
+	Start(paymentID string, baseAmount int64) (*PaymentWatch, error)
+	// Resume 서버 재시작 전에 시작된 결제의 입금 대기를 같은 계좌, 같은 금액으로 재개 (account가 비어 있으면 기본 계좌)
+	Resume(paymentID string, account string, amount int64) (*PaymentWatch, error)
+	// Poll 결제의 현재 확인 상태 조회 (외부 API를 직접 호출하지 않음)
+	Poll(paymentID string) PaymentCheck
+	// Cancel 입금 대기 해제
+	Cancel(paymentID string)
+	// Subscribe 예수금 변동 이벤트 구독 (모든 입금 계좌)
+	Subscribe() (<-chan DepositEvent, func())
+	// Accounts 입금 계좌별 예수금과 대기 중인 결제 (첫 번째가 기본 계좌)
+	Accounts() []AccountStatus
+}
+
+// PaymentWatch 입금 대기 중인 결제
+type PaymentWatch struct {
+	PaymentID string
+	Account   string              // 입금받을 계좌 ID
+	Payee     *PayeeConfig        // 입금받을 계좌의 QR 코드용 정보 (nil이면 기본 입금 계좌)
+	Amount    int64               // 고객이 입금해야 할 금액 (오프셋 포함)
+	Baseline  int64               // 입금 대기 등록 시점의 예수금 (재시작 후 복구 기준)
+	Confirmed <-chan PaymentMatch // 입금이 할당될 때마다 전달됨 (부족 입금이면 추가 입금 시 다시 전달)
+}
+
+// PaymentCheck 결제 확인 상태
+type PaymentCheck struct {
+	Pending   bool          // 아직 입금을 기다리는 중
+	Balance   int64         // 마지막으로 관측된 예수금
+	LastError error         // 마지막 예수금 조회 오류
+	Health    *SourceHealth // 예수금 조회 대상 상태 (지원하는 경우)
+}
+
+// Degraded 예수금 조회가 원활하지 않아 입금 확인이 지연될 수 있는지
+func (c PaymentCheck) Degraded() bool {
+	if c.Health != nil {
+		return c.Health.Degraded()
+	}
+	return c.LastError != nil
+}
+
+// DepositAccount 입금을 받는 계좌 (계좌마다 예수금 상태와 폴러가 따로 동작)
+type DepositAccount struct {
+	ID    string // 계좌 식별자 (결제 기록에 저장되어 재시작 후 같은 계좌에서 입금을 기다림)
+	Label string // 화면/로그용 이름
+	State *DepositState
+	Payee *PayeeConfig // 이 계좌로 받을 때 QR 코드에 표시할 입금 계좌 (nil이면 기본 입금 계좌)
+}
+
+// NewDepositAccount 새로운 입금 계좌 생성
+func NewDepositAccount(id, label string, source BalanceSource) *DepositAccount {
+	state := NewDepositState(source)
+	state.account = id
+	return &DepositAccount{ID: id, Label: label, State: state}
+}
+
+// check 계좌의 예수금 조회 상태
+func (a *DepositAccount) check(paymentID string) PaymentCheck {
+	check := PaymentCheck{
+		Pending:   paymentID != "" && a.State.IsPending(paymentID),
+		Balance:   a.State.GetCurrentDeposit(),
+		LastError: a.State.LastPollError(),
+	}
+	if health, ok := a.State.SourceHealth(); ok {
+		check.Health = &health
+	}
+	return check
+}
+
+// AccountStatus 입금 계좌별 예수금과 대기 중인 결제 (관리자 API)
+type AccountStatus struct {
+	ID            string           `json:"id"`
+	Label         string           `json:"label"`
+	Balance       int64            `json:"balance"` // 마지막으로 관측된 예수금
+	PendingCount  int              `json:"pending_count"`
+	Pending       []PendingPayment `json:"pending"`
+	Degraded      bool             `json:"degraded"`
+	Health        *SourceHealth    `json:"health,omitempty"`
+	LastPollError string           `json:"last_poll_error,omitempty"`
+	Payee         *PayeeConfig     `json:"payee,omitempty"`
+}
+
+// DepositProvider 예수금 변동을 감시하여 입금을 확인하는 제공자 (KIS 계좌 이체)
+// 입금 계좌가 여러 개이면 새 결제마다 같은 금액의 대기 결제가 없고 대기 결제가 가장 적은 계좌를 골라,
+// 예수금 변동액만으로 결제를 구분하지 못하는 경우를 줄입니다.
+type DepositProvider struct {
+	name     string
+	accounts []*DepositAccount
+
+	mu          sync.Mutex
+	assignments map[string]accountAssignment // 결제 ID별 입금 계좌 (Start/Resume부터 Cancel까지)
+}
+
+// accountAssignment 결제에 배정된 입금 계좌
+type accountAssignment struct {
+	account    *DepositAccount
+	baseAmount int64
+}
+
+// NewDepositProvider 새로운 DepositProvider 생성 (첫 번째 계좌가 기본 계좌)
+func NewDepositProvider(name string, accounts ...*DepositAccount) *DepositProvider {
+	return &DepositProvider{
+		name:        name,
+		accounts:    accounts,
+		assignments: make(map[string]accountAssignment),
+	}
+}
+
+// Name 제공자 이름
+func (p *DepositProvider) Name() string {
+	return p.name
+}
+
+// Initialize 모든 입금 계좌의 초기 예수금 조회
+func (p *DepositProvider) Initialize() error {
+	for _, account := range p.accounts {
+		if err := account.State.Initialize(); err != nil {
+			return fmt.Errorf("%s: %v", account.Label, err)
+		}
+	}
+	return nil
+}
+
+// SetMaxAmountOffset 모든 입금 계좌의 금액 오프셋 최대값 설정
+func (p *DepositProvider) SetMaxAmountOffset(maxOffset int64) {
+	for _, account := range p.accounts {
+		account.State.SetMaxAmountOffset(maxOffset)
+	}
+}
+
+// SetMatchTolerance 모든 입금 계좌의 금액 불일치 허용 범위 설정
+func (p *DepositProvider) SetMatchTolerance(percent int64) {
+	for _, account := range p.accounts {
+		account.State.SetMatchTolerance(percent)
+	}
+}
+
+// SetPollInterval 모든 입금 계좌의 예수금 조회 간격 설정 (계좌마다 따로 조회)
+func (p *DepositProvider) SetPollInterval(interval time.Duration) {
+	for _, account := range p.accounts {
+		account.State.SetPollInterval(interval)
+	}
+}
+
+// SetPollSchedule 모든 입금 계좌에 결제 경과 시간별 예수금 조회 간격 설정
+func (p *DepositProvider) SetPollSchedule(schedule func(elapsed time.Duration) time.Duration) {
+	for _, account := range p.accounts {
+		account.State.SetPollSchedule(schedule)
+	}
+}
+
+// StartPolling 입금 계좌별 예수금 폴러 시작
+func (p *DepositProvider) StartPolling(ctx context.Context) {
+	for _, account := range p.accounts {
+		account.State.Start(ctx)
+	}
+}
+
+// account ID로 입금 계좌 조회 (비어 있으면 기본 계좌, 재시작 전 계좌 정보가 없던 결제 포함)
+func (p *DepositProvider) account(id string) *DepositAccount {
+	if id == "" {
+		return p.accounts[0]
+	}
+	for _, account := range p.accounts {
+		if account.ID == id {
+			return account
+		}
+	}
+	return nil
+}
+
+// assign 결제에 입금 계좌를 배정합니다.
+// 우선순위: 예수금 조회가 원활한 계좌 > 같은 금액의 대기 결제가 없는 계좌 > 대기 결제가 적은 계좌 > 먼저 설정된 계좌
+func (p *DepositProvider) assign(paymentID string, baseAmount int64) (*DepositAccount, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.assignments[paymentID]; exists {
+		return nil, fmt.Errorf("이미 등록된 결제입니다: %s", paymentID)
+	}
+
+	pendingCount := make(map[*DepositAccount]int)
+	sameAmount := make(map[*DepositAccount]bool)
+	for _, assignment := range p.assignments {
+		pendingCount[assignment.account]++
+		if assignment.baseAmount == baseAmount {
+			sameAmount[assignment.account] = true
+		}
+	}
+
+	var best *DepositAccount
+	var bestDegraded bool
+	for _, account := range p.accounts {
+		degraded := account.check("").Degraded()
+		if best != nil {
+			if degraded != bestDegraded {
+				if degraded {
+					continue
+				}
+			} else if sameAmount[account] != sameAmount[best] {
+				if sameAmount[account] {
+					continue
+				}
+			} else if pendingCount[account] >= pendingCount[best] {
+				continue
+			}
+		}
+		best, bestDegraded = account, degraded
+	}
+
+	p.assignments[paymentID] = accountAssignment{account: best, baseAmount: baseAmount}
+	return best, nil
+}
+
+// unassign 결제의 입금 계좌 배정 해제
+func (p *DepositProvider) unassign(paymentID string) *DepositAccount {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	assignment, ok := p.assignments[paymentID]
+	if !ok {
+		return nil
+	}
+	delete(p.assignments, paymentID)
+	return assignment.account
+}
+
+// assignedAccount 결제에 배정된 입금 계좌 (없으면 기본 계좌)
+func (p *DepositProvider) assignedAccount(paymentID string) *DepositAccount {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if assignment, ok := p.assignments[paymentID]; ok {
+		return assignment.account
+	}
+	return p.accounts[0]
+}
+
+// Start 입금 계좌를 골라 입금 대기 시작
+func (p *DepositProvider) Start(paymentID string, baseAmount int64) (*PaymentWatch, error) {
+	account, err := p.assign(paymentID, baseAmount)
+	if err != nil {
+		return nil, err
+	}
+	amount, baseline, confirmed, err := account.State.RegisterPayment(paymentID, baseAmount)
+	if err != nil {
+		p.unassign(paymentID)
+		return nil, err
+	}
+	return &PaymentWatch{PaymentID: paymentID, Account: account.ID, Payee: account.Payee,
+		Amount: amount, Baseline: baseline, Confirmed: confirmed}, nil
+}
+
+// Resume 결제를 시작한 계좌에서 입금 대기 재개
+func (p *DepositProvider) Resume(paymentID string, accountID string, amount int64) (*PaymentWatch, error) {
+	account := p.account(accountID)
+	if account == nil {
+		return nil, fmt.Errorf("입금 계좌를 찾을 수 없습니다: %s", accountID)
+	}
+
+	p.mu.Lock()
+	if _, exists := p.assignments[paymentID]; exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("이미 등록된 결제입니다: %s", paymentID)
+	}
+	p.assignments[paymentID] = accountAssignment{account: account, baseAmount: amount}
+	p.mu.Unlock()
+
+	baseline, confirmed, err := account.State.ResumePayment(paymentID, amount)
+	if err != nil {
+		p.unassign(paymentID)
+		return nil, err
+	}
+	return &PaymentWatch{PaymentID: paymentID, Account: account.ID, Payee: account.Payee,
+		Amount: amount, Baseline: baseline, Confirmed: confirmed}, nil
+}
+
+// Poll 결제 확인 상태 조회 (결제가 배정된 계좌 기준)
+func (p *DepositProvider) Poll(paymentID string) PaymentCheck {
+	return p.assignedAccount(paymentID).check(paymentID)
+}
+
+// Cancel 입금 대기 해제
+func (p *DepositProvider) Cancel(paymentID string) {
+	if account := p.unassign(paymentID); account != nil {
+		account.State.UnregisterPayment(paymentID)
+	}
+}
+
+// Subscribe 모든 입금 계좌의 예수금 변동 이벤트 구독
+func (p *DepositProvider) Subscribe() (<-chan DepositEvent, func()) {
+	if len(p.accounts) == 1 {
+		return p.accounts[0].State.Subscribe()
+	}
+
+	merged := make(chan DepositEvent, 16)
+	unsubscribes := make([]func(), 0, len(p.accounts))
+	var wg sync.WaitGroup
+	for _, account := range p.accounts {
+		events, unsubscribe := account.State.Subscribe()
+		unsubscribes = append(unsubscribes, unsubscribe)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range events {
+				merged <- event
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			for _, unsubscribe := range unsubscribes {
+				unsubscribe()
+			}
+			// 구독 해제 후 남은 이벤트를 비워 전달 고루틴이 끝나도록 함
+			go func() {
+				for range merged {
+				}
+			}()
+		})
+	}
+	return merged, unsubscribe
+}
+
+// Accounts 입금 계좌별 예수금과 대기 중인 결제
+func (p *DepositProvider) Accounts() []AccountStatus {
+	statuses := make([]AccountStatus, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		check := account.check("")
+		pending := account.State.PendingPayments()
+		status := AccountStatus{
+			ID:           account.ID,
+			Label:        account.Label,
+			Balance:      check.Balance,
+			PendingCount: len(pending),
+			Pending:      pending,
+			Degraded:     check.Degraded(),
+			Health:       check.Health,
+			Payee:        account.Payee,
+		}
+		if check.LastError != nil {
+			status.LastPollError = check.LastError.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// SimulatedAccount 메모리상의 가상 계좌 (시뮬레이터용 BalanceSource)
+type SimulatedAccount struct {
+	mu      sync.Mutex
+	balance int64
+}
+
+// GetDepositAmount 가상 계좌 잔액 조회
+func (a *SimulatedAccount) GetDepositAmount() (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.balance, nil
+}
+
+// Deposit 가상 계좌에 입금 (음수면 출금)
+func (a *SimulatedAccount) Deposit(amount int64) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balance += amount
+	return a.balance
+}
+
+// SimulatorProvider KIS 없이 동작하는 시뮬레이터 제공자
+// 관리자 API로 가상 계좌에 입금하면 실제 KIS 계좌와 같은 폴링/매칭 과정을 거쳐 결제가 확인됩니다.
+type SimulatorProvider struct {
+	*DepositProvider
+	simulated map[string]*SimulatedAccount // 입금 계좌 ID별 가상 계좌
+}
+
+// NewSimulatorProvider 새로운 SimulatorProvider 생성 (가상 계좌 accountCount개, 최소 1개)
+func NewSimulatorProvider(initialBalance int64, accountCount int) *SimulatorProvider {
+	if accountCount < 1 {
+		accountCount = 1
+	}
+	simulated := make(map[string]*SimulatedAccount, accountCount)
+	accounts := make([]*DepositAccount, 0, accountCount)
+	for i := 1; i <= accountCount; i++ {
+		id := fmt.Sprintf("sim-%d", i)
+		simulated[id] = &SimulatedAccount{balance: initialBalance}
+		accounts = append(accounts, NewDepositAccount(id, fmt.Sprintf("시뮬레이터 계좌 %d", i), simulated[id]))
+	}
+	return &SimulatorProvider{
+		DepositProvider: NewDepositProvider(ProviderSimulator, accounts...),
+		simulated:       simulated,
+	}
+}
+
+// Balance 가상 계좌 잔액 (폴러가 아직 관측하지 않은 입금 포함)
+func (p *SimulatorProvider) Balance(accountID string) (int64, error) {
+	account := p.account(accountID)
+	if account == nil {
+		return 0, fmt.Errorf("가상 계좌를 찾을 수 없습니다: %s", accountID)
+	}
+	return p.simulated[account.ID].GetDepositAmount()
+}
+
+// Deposit 가상 계좌에 임의 금액 입금 (accountID가 비어 있으면 기본 계좌)
+func (p *SimulatorProvider) Deposit(accountID string, amount int64) (int64, error) {
+	account := p.account(accountID)
+	if account == nil {
+		return 0, fmt.Errorf("가상 계좌를 찾을 수 없습니다: %s", accountID)
+	}
+	return p.simulated[account.ID].Deposit(amount), nil
+}
+
+// DepositFor 대기 중인 결제의 입금 금액만큼 결제가 배정된 가상 계좌에 입금
+func (p *SimulatorProvider) DepositFor(paymentID string) (accountID string, amount int64, err error) {
+	for _, account := range p.accounts {
+		for _, pending := range account.State.PendingPayments() {
+			if pending.PaymentID == paymentID {
+				p.simulated[account.ID].Deposit(pending.Outstanding())
+				return account.ID, pending.Outstanding(), nil
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("입금 대기 중인 결제를 찾을 수 없습니다: %s", paymentID)
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTokenRefreshBefore 만료 몇 분 전에 미리 토큰을 재발급할지
+	DefaultTokenRefreshBefore = 1 * time.Hour
+	// tokenMinValidity 남은 유효 시간이 이보다 짧은 토큰은 사용하지 않고 재발급
+	tokenMinValidity = 1 * time.Minute
+	// tokenRetryInterval 선제 재발급 실패 시 재시도 간격
+	tokenRetryInterval = 1 * time.Minute
+)
+
+// TokenFetcher 새 토큰을 발급받는 함수 (토큰과 실제 만료 시각 반환)
+type TokenFetcher func() (token string, expiresAt time.Time, err error)
+
+// TokenManager KIS 접근 토큰을 관리합니다.
+// 여러 결제 고루틴이 동시에 토큰을 요청해도 재발급은 한 번만 수행되며(진행 중인 재발급을 공유),
+// 발급받은 토큰과 만료 시각을 파일에 저장해 재시작 시 다시 사용합니다.
+type TokenManager struct {
+	mu            sync.Mutex
+	token         string
+	expiresAt     time.Time
+	fetch         TokenFetcher
+	cachePath     string
+	cacheKey      string // 다른 앱키의 캐시를 사용하지 않도록 저장하는 앱키 지문
+	refreshBefore time.Duration
+	inflight      *tokenRefresh
+	changed       chan struct{} // 토큰이 바뀌면 선제 재발급 루프를 깨움
+}
+
+// tokenRefresh 진행 중인 재발급 (대기 중인 호출자들이 결과를 공유)
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// tokenCache 토큰 캐시 파일 형식
+type tokenCache struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Key         string    `json:"key"`
+	IssuedAt    time.Time `json:"issued_at"`
+}
+
+// NewTokenManager 새로운 TokenManager 생성
+// cacheKey는 캐시 파일이 같은 자격 증명으로 발급된 것인지 확인하는 데 사용됩니다 (예: 앱키).
+func NewTokenManager(fetch TokenFetcher, cacheKey string) *TokenManager {
+	sum := sha256.Sum256([]byte(cacheKey))
+	return &TokenManager{
+		fetch:         fetch,
+		cacheKey:      hex.EncodeToString(sum[:8]),
+		refreshBefore: DefaultTokenRefreshBefore,
+		changed:       make(chan struct{}, 1),
+	}
+}
+
+// SetRefreshBefore 만료 전 선제 재발급 시점 설정
+func (tm *TokenManager) SetRefreshBefore(d time.Duration) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.refreshBefore = d
+}
+
+// SetCachePath 토큰 캐시 파일 경로를 설정하고, 유효한 캐시가 있으면 불러옵니다
+func (tm *TokenManager) SetCachePath(path string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.cachePath = path
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("토큰 캐시 읽기 실패: %v", err)
+	}
+
+	var cache tokenCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return fmt.Errorf("토큰 캐시 파싱 실패: %v", err)
+	}
+	if cache.Key != tm.cacheKey {
+		log.Println("토큰 캐시가 다른 앱키로 발급되어 사용하지 않습니다")
+		return nil
+	}
+	if time.Until(cache.ExpiresAt) < tokenMinValidity {
+		log.Println("토큰 캐시가 만료되어 사용하지 않습니다")
+		return nil
+	}
+
+	tm.token = cache.AccessToken
+	tm.expiresAt = cache.ExpiresAt
+	log.Printf("저장된 KIS 토큰 사용 (만료: %s)", cache.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// Token 유효한 토큰을 반환합니다. 토큰이 없거나 곧 만료되면 재발급합니다.
+func (tm *TokenManager) Token() (string, error) {
+	tm.mu.Lock()
+	if tm.token != "" && time.Until(tm.expiresAt) > tokenMinValidity {
+		token := tm.token
+		tm.mu.Unlock()
+		return token, nil
+	}
+	tm.mu.Unlock()
+
+	return tm.Refresh()
+}
+
+// ExpiresAt 현재 토큰의 만료 시각
+func (tm *TokenManager) ExpiresAt() time.Time {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.expiresAt
+}
+
+// Invalidate 현재 토큰을 폐기합니다 (API가 토큰 만료를 응답한 경우)
+// token이 현재 토큰과 다르면 이미 재발급된 것이므로 무시합니다.
+func (tm *TokenManager) Invalidate(token string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if token == "" || tm.token == token {
+		tm.token = ""
+		tm.expiresAt = time.Time{}
+	}
+}
+
+// Refresh 토큰을 재발급합니다. 이미 재발급이 진행 중이면 그 결과를 기다립니다.
+func (tm *TokenManager) Refresh() (string, error) {
+	tm.mu.Lock()
+	if r := tm.inflight; r != nil {
+		tm.mu.Unlock()
+		<-r.done
+		return r.token, r.err
+	}
+	r := &tokenRefresh{done: make(chan struct{})}
+	tm.inflight = r
+	tm.mu.Unlock()
+
+	token, expiresAt, err := tm.fetch()
+
+	tm.mu.Lock()
+	if err == nil {
+		tm.token = token
+		tm.expiresAt = expiresAt
+		tm.saveLocked()
+	}
+	tm.inflight = nil
+	tm.mu.Unlock()
+
+	r.token, r.err = token, err
+	close(r.done)
+
+	if err == nil {
+		select {
+		case tm.changed <- struct{}{}:
+		default:
+		}
+	}
+	return token, err
+}
+
+// saveLocked 토큰을 캐시 파일에 저장 (tm.mu 잠금 상태에서 호출)
+func (tm *TokenManager) saveLocked() {
+	if tm.cachePath == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(tokenCache{
+		AccessToken: tm.token,
+		ExpiresAt:   tm.expiresAt,
+		Key:         tm.cacheKey,
+		IssuedAt:    time.Now(),
+	}, "", "  ")
+	if err != nil {
+		log.Printf("토큰 캐시 저장 실패: %v", err)
+		return
+	}
+
+	// 임시 파일에 쓴 뒤 교체하여 쓰는 도중 종료되어도 캐시가 깨지지 않게 함
+	if dir := filepath.Dir(tm.cachePath); dir != "" {
+		os.MkdirAll(dir, 0700)
+	}
+	tmp := tm.cachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("토큰 캐시 저장 실패: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, tm.cachePath); err != nil {
+		log.Printf("토큰 캐시 저장 실패: %v", err)
+	}
+}
+
+// Run 만료 전에 토큰을 선제적으로 재발급합니다 (ctx가 끝날 때까지 실행)
+func (tm *TokenManager) Run(ctx context.Context) {
+	for {
+		tm.mu.Lock()
+		remaining := time.Until(tm.expiresAt)
+		wait := remaining - tm.refreshBefore
+		// 유효 기간이 짧은 토큰은 남은 시간의 절반이 지나면 재발급
+		if wait < remaining/2 {
+			wait = remaining / 2
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+		if tm.token == "" {
+			wait = 0
+		}
+		tm.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+			log.Println("토큰 재발급 시도 중...")
+			if _, err := tm.Refresh(); err != nil {
+				log.Printf("토큰 재발급 실패: %v", err)
+				// 실패하면 잠시 후 다시 시도 (기존 토큰은 만료 전까지 계속 사용)
+				select {
+				case <-time.After(tokenRetryInterval):
+				case <-ctx.Done():
+					log.Println("토큰 재발급 고루틴 종료")
+					return
+				}
+				continue
+			}
+			log.Printf("KIS API 토큰 재발급 성공 (만료: %s)", tm.ExpiresAt().Local().Format("2006-01-02 15:04:05"))
+
+		case <-tm.changed:
+			// 다른 경로로 재발급됨 - 다음 재발급 시점 다시 계산
+
+		case <-ctx.Done():
+			log.Println("토큰 재발급 고루틴 종료")
+			return
+		}
+	}
+}
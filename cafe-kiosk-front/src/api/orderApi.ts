@@ -19,14 +19,15 @@ export interface OrderItem {
 export interface Order {
   id: number;
   total_price: number;
+  status: string;
   created_at: string;
   updated_at: string;
   order_items: OrderItem[];
 }
 
-// 주문 목록 조회 (Order + OrderItems + Menu)
+// 주문 목록 조회 (Order + OrderItems + Menu) - 결제 완료된 주문만
 export async function getOrders(): Promise<Order[]> {
-  const res = await apiClient.get('/orders');
+  const res = await apiClient.get('/orders?status=paid');
   return res.data;
 }
 
@@ -12,6 +12,30 @@ export interface PaymentResponse {
   };
 }
 
+export interface CreatedOrder {
+  id: number;
+  total_price: number;
+  status: string;
+}
+
+export interface PaymentQR {
+  payment_id: string;
+  order_id: number;
+  amount: number;
+  order_amount: number;
+  payee: {
+    store_name?: string;
+    bank_name: string;
+    account_no: string;
+    account_holder?: string;
+  };
+  toss_link: string;
+  transfer_text: string;
+  qr_png: string;
+  transfer_link?: string; // 토스 외의 송금 앱용 딥링크 (설정된 경우만)
+  transfer_qr_png?: string;
+}
+
 export interface OrderRequest {
   items: Array<{
     menu_id: number;
@@ -19,19 +43,30 @@ export interface OrderRequest {
   }>;
 }
 
+// 중복 요청 방지 키 - 같은 주문/결제 시도의 재전송에는 같은 키를 사용 (서버가 처음 결과를 돌려줌)
+export const newRequestKey = () => `${Date.now().toString(36)}-${Math.random().toString(36).slice(2, 10)}`;
+
 export const PaymentAPI = {
   // 결제 요청 보내기
   requestPayment: (amount: number) => {
     return apiClient.post<PaymentResponse>('/payment', { amount });
   },
 
-  postOrder: (cartItems: CartItem[]) => {
+  // 주문 생성 - 같은 주문의 재시도에는 같은 requestKey를 보내야 주문이 두 번 생기지 않음
+  postOrder: (cartItems: CartItem[], requestKey: string) => {
     // 백엔드 API 형식에 맞게 데이터 변환
     const items = cartItems.map(item => ({
       menu_id: item.item.id,
       quantity: item.quantity
     }));
     
-    return apiClient.post<OrderRequest>('/orders', { items });
+    return apiClient.post<CreatedOrder>('/orders', { items }, {
+      headers: { 'Idempotency-Key': requestKey }
+    });
+  },
+
+  // 결제 QR 코드와 딥링크 (서버가 결정한 금액과 입금 계좌)
+  getPaymentQR: (paymentId: string) => {
+    return apiClient.get<PaymentQR>(`/payments/${paymentId}/qr`);
   },
 };
\ No newline at end of file